@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states, as exported by mesos_exporter_circuit_state.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops fetching an endpoint after threshold consecutive
+// failures. Once the cooldown has passed, a single fetch probes the endpoint
+// again and either closes the breaker or opens it for another cooldown.
+type circuitBreaker struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     int
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether the endpoint may be fetched now.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// A probe is already in flight.
+		return false
+	}
+	return true
+}
+
+// record accounts the outcome of a fetch allowed by allow.
+func (b *circuitBreaker) record(ok bool, now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	if ok {
+		b.failures = 0
+		b.state = circuitClosed
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = now
+	}
+}
+
+func (b *circuitBreaker) current() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+// circuitBreakers holds the breakers of the endpoints fetched by a client.
+type circuitBreakers struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	endpoints map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(threshold int, cooldown time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		endpoints: map[string]*circuitBreaker{},
+	}
+}
+
+func (bs *circuitBreakers) get(endpoint string) *circuitBreaker {
+	bs.Lock()
+	defer bs.Unlock()
+	b, ok := bs.endpoints[endpoint]
+	if !ok {
+		b = newCircuitBreaker(bs.threshold, bs.cooldown)
+		bs.endpoints[endpoint] = b
+	}
+	return b
+}
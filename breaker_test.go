@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if !b.allow(now) {
+			t.Fatalf("failure #%d: breaker opened too early", i)
+		}
+		b.record(false, now)
+	}
+	if got := b.current(); got != circuitOpen {
+		t.Fatalf("got state %d after 2 failures, want open", got)
+	}
+	if b.allow(now.Add(30 * time.Second)) {
+		t.Error("open breaker allowed a fetch within the cooldown")
+	}
+
+	// The probe after the cooldown fails and opens the breaker again.
+	now = now.Add(time.Minute)
+	if !b.allow(now) {
+		t.Fatal("breaker did not allow a probe after the cooldown")
+	}
+	if b.allow(now) {
+		t.Error("half-open breaker allowed a second probe")
+	}
+	b.record(false, now)
+	if b.allow(now.Add(30 * time.Second)) {
+		t.Error("breaker allowed a fetch after a failed probe")
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	if !b.allow(now) {
+		t.Fatal("breaker did not allow a probe after the cooldown")
+	}
+	b.record(true, now)
+	if got := b.current(); got != circuitClosed {
+		t.Errorf("got state %d after a successful probe, want closed", got)
+	}
+}
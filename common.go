@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -19,6 +29,7 @@ type (
 	resources struct {
 		CPUs  float64 `json:"cpus"`
 		Disk  float64 `json:"disk"`
+		GPUs  float64 `json:"gpus"`
 		Mem   float64 `json:"mem"`
 		Ports ranges  `json:"ports"`
 	}
@@ -34,6 +45,8 @@ type (
 		Labels      []label   `json:"labels"`
 		Resources   resources `json:"resources"`
 		Statuses    []status  `json:"statuses"`
+		// HealthCheck is only set for tasks with a health check
+		HealthCheck json.RawMessage `json:"health_check"`
 	}
 
 	label struct {
@@ -44,6 +57,8 @@ type (
 	status struct {
 		State     string  `json:"state"`
 		Timestamp float64 `json:"timestamp"`
+		// Healthy is only set by the health check of the task
+		Healthy *bool `json:"healthy"`
 	}
 
 	tokenResponse struct {
@@ -63,6 +78,66 @@ type (
 	}
 )
 
+// number is a float64 decoded from either a JSON number or a quoted number,
+// as sent by some Mesos versions and proxies.
+type number float64
+
+func (n *number) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number: %s", data)
+	}
+	*n = number(f)
+	return nil
+}
+
+// scalar is a resource quantity. Agents with static reservations may
+// annotate it with the reservation, as an object holding the quantity in
+// value, such as {"value": 2, "role": "web"}.
+type scalar float64
+
+func (s *scalar) UnmarshalJSON(data []byte) error {
+	var n number
+	if len(data) > 0 && data[0] == '{' {
+		var annotated struct {
+			Value number `json:"value"`
+		}
+		if err := json.Unmarshal(data, &annotated); err != nil {
+			return err
+		}
+		n = annotated.Value
+	} else if err := n.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*s = scalar(n)
+	return nil
+}
+
+func (r *resources) UnmarshalJSON(data []byte) error {
+	var rs struct {
+		CPUs  scalar `json:"cpus"`
+		Disk  scalar `json:"disk"`
+		GPUs  scalar `json:"gpus"`
+		Mem   scalar `json:"mem"`
+		Ports ranges `json:"ports"`
+	}
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return err
+	}
+	*r = resources{
+		CPUs:  float64(rs.CPUs),
+		Disk:  float64(rs.Disk),
+		GPUs:  float64(rs.GPUs),
+		Mem:   float64(rs.Mem),
+		Ports: rs.Ports,
+	}
+	return nil
+}
+
 type groupedCollector struct {
 	Collectors []prometheus.Collector
 }
@@ -83,22 +158,123 @@ func (c *groupedCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-func newStandardCollector(httpClient *httpClient, metrics map[prometheus.Collector]metricsCollectorFunctor) prometheus.Collector {
+// timedCollector reports the time elapsed since the previous collection of
+// the wrapped collector, which grows when Prometheus stops scraping.
+type timedCollector struct {
+	prometheus.Collector
+	desc *prometheus.Desc
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newTimedCollector(name string, c prometheus.Collector) prometheus.Collector {
+	return &timedCollector{
+		Collector: c,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName("mesos_exporter", "", "time_since_last_scrape_seconds"),
+			"Seconds between the current and the previous collection of the collector",
+			nil,
+			prometheus.Labels{"collector": name}),
+	}
+}
+
+func (c *timedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+	c.Collector.Describe(ch)
+}
+
+func (c *timedCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	c.mu.Lock()
+	last := c.last
+	c.last = now
+	c.mu.Unlock()
+
+	// There's nothing to compare the first collection with.
+	if !last.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, now.Sub(last).Seconds())
+	}
+	c.Collector.Collect(ch)
+}
+
+func newStandardCollector(fetcher fetcher, metrics map[prometheus.Collector]metricsCollectorFunctor, opts collectorOptions) prometheus.Collector {
 	return newGroupedCollector(
-		newMetricCollector(httpClient, metrics),
-		newVersionCollector(httpClient),
+		newMetricCollector(fetcher, metrics, opts),
+		newVersionCollector(fetcher, opts),
 	)
 }
 
+// collectorOptions configures the metrics of the collectors of masters and
+// agents alike. Its zero value exports them as without the flags setting it.
+type collectorOptions struct {
+	// Masters briefly serve an empty /metrics/snapshot after starting.
+	// retryEmptySnapshot fetches an empty snapshot once more, and
+	// keepLastSnapshot exports the last snapshot with metrics in place of
+	// an empty one.
+	retryEmptySnapshot bool
+	keepLastSnapshot   bool
+	// formatBuildTime formats the build_time label of mesos_version, as a
+	// float if nil
+	formatBuildTime func(float64) string
+	// memUnit is the unit memory and disk sizes are exported in, bytes if
+	// unset
+	memUnit memoryUnit
+	// parentRoleLabel adds a parent_role label to the metrics by role,
+	// which lets hierarchical roles such as eng/team-a be rolled up
+	parentRoleLabel bool
+}
+
 type metricMap map[string]float64
 
+// UnmarshalJSON decodes a snapshot whose values may be quoted numbers. Values
+// which aren't numbers are skipped so they don't fail the whole snapshot.
+func (m *metricMap) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = make(metricMap, len(raw))
+	for key, value := range raw {
+		var n number
+		if err := n.UnmarshalJSON(value); err != nil || string(value) == "null" {
+			log.WithFields(log.Fields{
+				"key":   key,
+				"value": string(value),
+			}).Debug("skipping non-numeric snapshot value")
+			continue
+		}
+		(*m)[key] = float64(n)
+	}
+	return nil
+}
+
 type metricsCollectorFunctor func(metricMap, prometheus.Collector) error
 
 const LogErrNotFoundInMap = "Couldn't find key in map"
 
+// errOptionalKeyMissing is returned by functors for snapshot keys which not
+// every master reports. Their metric is left out of the scrape without
+// counting an error.
+var errOptionalKeyMissing = errors.New("optional key missing from snapshot")
+
+// optional looks up a snapshot key which may be missing.
+func (m metricMap) optional(key string) (float64, error) {
+	value, ok := m[key]
+	if !ok {
+		return 0, errOptionalKeyMissing
+	}
+	return value, nil
+}
+
+// settableCounterVec exports counters whose values are read from Mesos. The
+// values are kept, and collected again, until Reset is called.
 type settableCounterVec struct {
-	desc   *prometheus.Desc
-	values []prometheus.Metric
+	desc *prometheus.Desc
+
+	mu sync.Mutex
+	// values are keyed by their joined label values
+	values map[string]prometheus.Metric
 }
 
 func (c *settableCounterVec) Describe(ch chan<- *prometheus.Desc) {
@@ -106,15 +282,31 @@ func (c *settableCounterVec) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *settableCounterVec) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for _, v := range c.values {
 		ch <- v
 	}
-
-	c.values = nil
 }
 
+// Set sets the counter with the given label values, replacing its last
+// value.
 func (c *settableCounterVec) Set(value float64, labelValues ...string) {
-	c.values = append(c.values, prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, value, labelValues...))
+	m := prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, value, labelValues...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = map[string]prometheus.Metric{}
+	}
+	c.values[strings.Join(labelValues, "\xff")] = m
+}
+
+// Reset drops all values, for the label values no longer reported by Mesos
+// to stop being exported.
+func (c *settableCounterVec) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = nil
 }
 
 type settableCounter struct {
@@ -168,10 +360,7 @@ func counter(subsystem, name, help string, labels ...string) *settableCounterVec
 		prometheus.Labels{},
 	)
 
-	return &settableCounterVec{
-		desc:   desc,
-		values: nil,
-	}
+	return &settableCounterVec{desc: desc}
 }
 
 type authInfo struct {
@@ -184,6 +373,24 @@ type authInfo struct {
 	strictMode    bool
 	privateKey    string
 	skipSSLVerify bool
+	// tokenFile, if set, provides the token instead of a strict mode login
+	tokenFile *tokenFile
+	// digest authenticates with username and password by HTTP digest
+	// instead of basic authentication
+	digest bool
+}
+
+// optionalEndpoints are not served by every Mesos build. A 404 from one of
+// them is a successful fetch that leaves the target untouched.
+var optionalEndpoints = map[string]bool{
+	"/version": true,
+}
+
+// fetcher fetches an endpoint of a Mesos master or agent and decodes its
+// JSON response into target. It is implemented by httpClient and faked by
+// the tests of the collectors.
+type fetcher interface {
+	fetchAndDecode(endpoint string, target interface{}) bool
 }
 
 type httpClient struct {
@@ -191,14 +398,187 @@ type httpClient struct {
 	url       string
 	auth      authInfo
 	userAgent string
+	// failover, if set, takes precedence over url
+	failover         *endpointList
+	maxResponseBytes int64
+	// apiVersion is the Mesos API version used where both exist, v0 or v1
+	apiVersion string
+	// loginTimeout, if set, bounds strict mode logins
+	loginTimeout time.Duration
+	// breakers, if set, stop fetching endpoints that keep failing
+	breakers *circuitBreakers
+	// headers are added to every request, including logins
+	headers http.Header
+	// hostHeader, if set, replaces the host of the URL in the Host header
+	// of the requests to the master and of logins
+	hostHeader string
+	// sendRequestID sends the scrape id as X-Request-ID
+	sendRequestID bool
+	// acceptZstd negotiates zstd and gzip encoded responses, instead of
+	// leaving gzip to the transport
+	acceptZstd bool
+	// salvageTruncatedState exports the fields of a /state response cut
+	// short that were received in full, instead of failing the fetch
+	salvageTruncatedState bool
+	// slaveAuth sends the credentials used for the master to the agents
+	// fetched by the same client as well
+	slaveAuth bool
+	// fanout bounds the parallel requests of collectors fanning out to agents
+	fanout semaphore
+	// debugState, if set, keeps the last v0 /state response of every
+	// master for /debug/state
+	debugState *stateCache
+	// metrics, if set, report the fetches of the target the client belongs
+	// to
+	metrics *targetMetrics
+	// scrape, if set, gives the id of the scrape the client fetches for
+	scrape *scrapeScope
+
+	// authMu guards the strict mode token in auth, which is shared by all
+	// collectors using the client
+	authMu sync.Mutex
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// redirectError is returned by the redirect policy of clients refusing to
+// follow redirects.
+type redirectError struct {
+	location string
+}
+
+func (e *redirectError) Error() string {
+	return "refusing to follow redirect to " + e.location
+}
+
+// redirectLocation returns the target of a refused redirect.
+func redirectLocation(err error) (string, bool) {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	if rerr, ok := err.(*redirectError); ok {
+		return rerr.location, true
+	}
+	return "", false
+}
+
+var errResponseTooLarge = errors.New("response body exceeds the size limit")
+
+// limitedReader reads at most n bytes from r and fails with
+// errResponseTooLarge if r holds more than that.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errResponseTooLarge
+	}
+	// Read one byte past the limit to tell a body of exactly n bytes
+	// from a larger one.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errResponseTooLarge
+	}
+	return n, err
+}
+
+// bodySnippetBytes is how much of a response that isn't JSON is logged.
+const bodySnippetBytes = 256
+
+// notJSON tells if the response with the content type ct and a body starting
+// with head isn't JSON, such as the HTML error page of a proxy or of a
+// service other than Mesos. As not every server sets the content type, a
+// body that looks like JSON is decoded whatever the header says.
+func notJSON(ct string, head []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(ct); err == nil {
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return false
+		}
+	}
+	head = bytes.TrimLeft(head, " \t\r\n")
+	return len(head) > 0 && head[0] != '{' && head[0] != '['
+}
+
+// buildTimeFormats format the build_time label of mesos_version, by the name
+// given to -versionBuildTime.
+var buildTimeFormats = map[string]func(float64) string{
+	"float": func(t float64) string {
+		return fmt.Sprintf("%f", t)
+	},
+	"rfc3339": func(t float64) string {
+		return time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+	},
+}
+
+// buildTime formats the build_time label of mesos_version.
+func (opts collectorOptions) buildTime(t float64) string {
+	if opts.formatBuildTime == nil {
+		return buildTimeFormats["float"](t)
+	}
+	return opts.formatBuildTime(t)
+}
+
+// memoryUnit is a unit the memory and disk sizes Mesos reports in MiB are
+// exported in. The unit is part of the metric names so that changing it
+// doesn't silently change the meaning of a series.
+type memoryUnit struct {
+	suffix string
+	perMiB float64
+}
+
+// memoryUnits are the units of memory and disk sizes, by the name given to
+// -memoryUnit.
+var memoryUnits = map[string]memoryUnit{
+	"bytes": {"bytes", 1024 * 1024},
+	"mib":   {"mebibytes", 1},
+}
+
+// unit returns the unit memory and disk sizes are exported in.
+func (opts collectorOptions) unit() memoryUnit {
+	if opts.memUnit == (memoryUnit{}) {
+		return memoryUnits["bytes"]
+	}
+	return opts.memUnit
+}
+
+// name replaces the _bytes suffix of name with the unit.
+func (u memoryUnit) name(name string) string {
+	return strings.TrimSuffix(name, "bytes") + u.suffix
+}
+
+// help replaces "in bytes" in help with the unit.
+func (u memoryUnit) help(help string) string {
+	return strings.Replace(help, "in bytes", "in "+u.suffix, 1)
+}
+
+// fromMiB converts mib to the unit.
+func (u memoryUnit) fromMiB(mib float64) float64 {
+	return mib * u.perMiB
 }
 
 type versionCollector struct {
-	*httpClient
-	metric *prometheus.GaugeVec
+	fetcher
+	metric          *prometheus.GaugeVec
+	formatBuildTime func(float64) string
 }
 
-func newVersionCollector(httpclient *httpClient) prometheus.Collector {
+func newVersionCollector(fetcher fetcher, opts collectorOptions) prometheus.Collector {
 	// example data
 	// "build_date": "2019-05-02 18:38:30",
 	// "build_time": 1556822310,
@@ -208,8 +588,9 @@ func newVersionCollector(httpclient *httpClient) prometheus.Collector {
 	// "version": "1.7.2"
 	labels := []string{"build_date", "build_time", "git_sha", "git_tag", "version"}
 	return &versionCollector{
-		httpclient,
+		fetcher,
 		gauge("", "version", "Version information for the mesos slave/master stored in labeling", labels...),
+		opts.buildTime,
 	}
 }
 
@@ -223,8 +604,8 @@ type versionFields struct {
 
 func (v *versionCollector) Collect(ch chan<- prometheus.Metric) {
 	var vf versionFields
-	if v.fetchAndDecode("/version", &vf) {
-		v.metric.WithLabelValues(vf.BuildDate, fmt.Sprintf("%f", vf.BuildTime), vf.GitSHA, vf.GitTag, vf.Version).Set(1)
+	if v.fetchAndDecode("/version", &vf) && vf.Version != "" {
+		v.metric.WithLabelValues(vf.BuildDate, v.formatBuildTime(vf.BuildTime), vf.GitSHA, vf.GitTag, vf.Version).Set(1)
 		v.metric.Collect(ch)
 	}
 }
@@ -234,12 +615,23 @@ func (v *versionCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 type metricCollector struct {
-	*httpClient
-	metrics map[prometheus.Collector]metricsCollectorFunctor
+	fetcher
+	metrics            map[prometheus.Collector]metricsCollectorFunctor
+	retryEmptySnapshot bool
+	keepLastSnapshot   bool
+
+	mu sync.Mutex
+	// last is the last snapshot with metrics, if keepLastSnapshot is set
+	last metricMap
 }
 
-func newMetricCollector(httpClient *httpClient, metrics map[prometheus.Collector]metricsCollectorFunctor) prometheus.Collector {
-	return &metricCollector{httpClient, metrics}
+func newMetricCollector(fetcher fetcher, metrics map[prometheus.Collector]metricsCollectorFunctor, opts collectorOptions) prometheus.Collector {
+	return &metricCollector{
+		fetcher:            fetcher,
+		metrics:            metrics,
+		retryEmptySnapshot: opts.retryEmptySnapshot,
+		keepLastSnapshot:   opts.keepLastSnapshot,
+	}
 }
 
 func signingToken(httpClient *httpClient) string {
@@ -248,8 +640,10 @@ func signingToken(httpClient *httpClient) string {
 		log.WithField("error", err).Error("Error parsing privateKey")
 	}
 
-	expireToken := time.Now().Add(time.Hour * 1).Unix()
+	issued := time.Now()
+	expireToken := issued.Add(time.Hour * 1).Unix()
 	httpClient.auth.tokenExpire = expireToken
+	httpClient.metrics.tokenIssued(issued, expireToken)
 
 	// Create the token
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
@@ -269,14 +663,43 @@ func signingToken(httpClient *httpClient) string {
 	return tokenString
 }
 
+func (httpClient *httpClient) addHeaders(req *http.Request) {
+	for name, values := range httpClient.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if id := httpClient.scrape.current(); httpClient.sendRequestID && id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+}
+
+// loginEndpoint returns the path of loginURL, which labels the errors of
+// logins like those of the endpoints of Mesos.
+func loginEndpoint(loginURL string) string {
+	u, err := url.Parse(loginURL)
+	if err != nil || u.Path == "" {
+		return "/login"
+	}
+	return u.Path
+}
+
 func authToken(httpClient *httpClient) string {
+	if httpClient.auth.tokenFile != nil {
+		return httpClient.auth.tokenFile.get()
+	}
+	// Collectors scraped in parallel wait for a single login.
+	httpClient.authMu.Lock()
+	defer httpClient.authMu.Unlock()
 	currentTime := time.Now().Unix()
 	if currentTime > httpClient.auth.tokenExpire {
+		httpClient.metrics.tokenRefreshed()
 		url := httpClient.auth.loginURL
 		signingToken := signingToken(httpClient)
 		body, err := json.Marshal(&tokenRequest{UID: httpClient.auth.username, Token: signingToken})
 		if err != nil {
 			log.WithField("error", err).Error("Error creating JSON request")
+			httpClient.metrics.setAuthHealthy(false)
 			return ""
 		}
 		buffer := bytes.NewBuffer(body)
@@ -286,17 +709,32 @@ func authToken(httpClient *httpClient) string {
 				"url":   url,
 				"error": err,
 			}).Error("Error creating HTTP request")
+			httpClient.metrics.setAuthHealthy(false)
 			return ""
 		}
+		if httpClient.loginTimeout > 0 {
+			ctx, cancel := context.WithTimeout(req.Context(), httpClient.loginTimeout)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
 		req.Header.Add("User-Agent", httpClient.userAgent)
 		req.Header.Add("Content-Type", "application/json")
+		httpClient.addHeaders(req)
+		if httpClient.hostHeader != "" {
+			req.Host = httpClient.hostHeader
+		}
+		log.WithFields(log.Fields{
+			"url":       url,
+			"scrape_id": httpClient.scrape.current(),
+		}).Debug("logging in")
 		res, err := httpClient.Do(req)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"url":   url,
 				"error": err,
 			}).Error("Error fetching URL")
-			errorCounter.Inc()
+			errorCounter.WithLabelValues(loginEndpoint(url), "login").Inc()
+			httpClient.metrics.setAuthHealthy(false)
 			return ""
 		}
 		defer res.Body.Close()
@@ -307,67 +745,361 @@ func authToken(httpClient *httpClient) string {
 				"url":   url,
 				"error": err,
 			}).Error("Error decoding response body")
-			errorCounter.Inc()
+			errorCounter.WithLabelValues(loginEndpoint(url), "login").Inc()
+			httpClient.metrics.setAuthHealthy(false)
 			return ""
 		}
 
 		httpClient.auth.token = fmt.Sprintf("token=%s", token.Token)
+		// A rejected login decodes as well, without a token.
+		if token.Token == "" {
+			httpClient.metrics.setAuthHealthy(false)
+		} else {
+			httpClient.metrics.setAuthHealthy(true)
+		}
+	} else {
+		httpClient.metrics.tokenReused()
 	}
 	return httpClient.auth.token
 }
 
+// credentials returns the settings authenticating the requests to baseURL,
+// none for agents unless slaveAuth is set. The strict mode token, which
+// authMu guards, is left out; requests get it from authToken.
+func (httpClient *httpClient) credentials(baseURL string) authInfo {
+	if !httpClient.slaveAuth && !httpClient.isMaster(baseURL) {
+		return authInfo{}
+	}
+	return authInfo{
+		username:   httpClient.auth.username,
+		password:   httpClient.auth.password,
+		strictMode: httpClient.auth.strictMode,
+		tokenFile:  httpClient.auth.tokenFile,
+		digest:     httpClient.auth.digest,
+	}
+}
+
+// invalidateToken makes the next authToken log in again, unless the token
+// rejected has already been replaced by another collector.
+func (httpClient *httpClient) invalidateToken(rejected string) {
+	httpClient.authMu.Lock()
+	defer httpClient.authMu.Unlock()
+	if httpClient.auth.token == rejected {
+		httpClient.auth.tokenExpire = 0
+	}
+}
+
 func (httpClient *httpClient) fetchAndDecode(endpoint string, target interface{}) bool {
-	url := strings.TrimSuffix(httpClient.url, "/") + endpoint
-	req, err := http.NewRequest("GET", url, nil)
+	var breaker *circuitBreaker
+	if httpClient.breakers != nil {
+		breaker = httpClient.breakers.get(endpoint)
+		if !breaker.allow(time.Now()) {
+			log.WithField("endpoint", endpoint).Debug("circuit open, skipping fetch")
+			httpClient.metrics.skipped(endpoint)
+			return false
+		}
+	}
+
+	ok, partial := false, false
+	if httpClient.failover == nil {
+		ok, partial = httpClient.fetchAndDecodeFrom(httpClient.url, endpoint, target)
+	} else {
+		for _, baseURL := range httpClient.failover.get() {
+			// A failed attempt may have decoded part of its response,
+			// which must not end up in target.
+			attempt := reflect.New(reflect.TypeOf(target).Elem())
+			if ok, partial = httpClient.fetchAndDecodeFrom(baseURL, endpoint, attempt.Interface()); ok {
+				reflect.ValueOf(target).Elem().Set(attempt.Elem())
+				break
+			}
+			log.WithField("master", baseURL).Debug("failing over to next master")
+		}
+	}
+
+	// A salvaged response is exported, but reported as a failed fetch.
+	httpClient.metrics.fetched(endpoint, ok && !partial)
+	if breaker != nil {
+		breaker.record(ok, time.Now())
+		httpClient.metrics.setCircuitState(endpoint, breaker.current())
+	}
+	return ok
+}
+
+func (httpClient *httpClient) fetchAndDecodeFrom(baseURL, endpoint string, target interface{}) (ok, partial bool) {
+	if call, ok := v1Calls[endpoint]; ok && httpClient.apiVersion == "v1" {
+		var res v1Response
+		body := []byte(fmt.Sprintf(`{"type":%q}`, call))
+		if ok, _ := httpClient.request(baseURL, endpoint, "POST", "/api/v1", body, &res, httpClient.metrics.masterClockSkew()); !ok {
+			return false, false
+		}
+		if err := res.convert(target); err != nil {
+			log.WithFields(log.Fields{
+				"call":  call,
+				"error": err,
+			}).Error("Error converting v1 operator API response")
+			errorCounter.WithLabelValues(endpoint, "decode").Inc()
+			return false, false
+		}
+		return true, false
+	}
+	return httpClient.request(baseURL, endpoint, "GET", endpoint, nil, target, httpClient.metrics.masterClockSkew())
+}
+
+func (httpClient *httpClient) responseTooLarge(url, endpoint string) {
+	log.WithFields(log.Fields{
+		"url":   url,
+		"limit": httpClient.maxResponseBytes,
+	}).Error("Response body exceeds the size limit")
+	errorCounter.WithLabelValues(endpoint, "too_large").Inc()
+}
+
+// isMaster tells the URLs of the master apart from those of the agents
+// fetched by the same client.
+func (httpClient *httpClient) isMaster(baseURL string) bool {
+	if httpClient.failover == nil {
+		return baseURL == httpClient.url
+	}
+	for _, u := range httpClient.failover.get() {
+		if u == baseURL {
+			return true
+		}
+	}
+	return false
+}
+
+// setClockSkew sets g to how far the clock of the server, going by the Date
+// header of its response, is ahead of the local clock at received. Date only
+// has a resolution of seconds, so the server clock is taken to be half a
+// second into the second.
+func setClockSkew(g prometheus.Gauge, date string, received time.Time) {
+	if date == "" {
+		return
+	}
+	t, err := http.ParseTime(date)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"date":  date,
+			"error": err,
+		}).Debug("Error parsing Date header")
+		return
+	}
+	g.Set(t.Add(500 * time.Millisecond).Sub(received).Seconds())
+}
+
+// request sends a request for path to the master or agent at baseURL and
+// decodes the JSON response into target. Errors are accounted to endpoint.
+// If clockSkew is given, it is set from the Date header of the response.
+// partial tells a response salvaged by -salvageTruncatedState, of which
+// target only got the fields received in full.
+func (httpClient *httpClient) request(baseURL, endpoint, method, path string, body []byte, target interface{}, clockSkew prometheus.Gauge) (ok, partial bool) {
+	url := strings.TrimSuffix(baseURL, "/") + path
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"url":   url,
 			"error": err,
 		}).Error("Error creating HTTP request")
-		return false
+		return false, false
 	}
 	req.Header.Add("User-Agent", httpClient.userAgent)
-	if httpClient.auth.username != "" && httpClient.auth.password != "" {
-		req.SetBasicAuth(httpClient.auth.username, httpClient.auth.password)
+	httpClient.addHeaders(req)
+	if httpClient.hostHeader != "" && httpClient.isMaster(baseURL) {
+		req.Host = httpClient.hostHeader
 	}
-	if httpClient.auth.strictMode {
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+	}
+	if httpClient.acceptZstd {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	auth := httpClient.credentials(baseURL)
+	if auth.username != "" && auth.password != "" && !auth.digest {
+		req.SetBasicAuth(auth.username, auth.password)
+	}
+	if auth.strictMode || auth.tokenFile != nil {
 		req.Header.Add("Authorization", authToken(httpClient))
 	}
-	log.WithField("url", url).Debug("fetching URL")
+	log.WithFields(log.Fields{
+		"url":       url,
+		"scrape_id": httpClient.scrape.current(),
+	}).Debug("fetching URL")
+	atomic.AddInt64(&inflightRequests, 1)
+	defer atomic.AddInt64(&inflightRequests, -1)
 	res, err := httpClient.Do(req)
+	if err == nil && res.StatusCode == http.StatusUnauthorized && auth.strictMode {
+		// The token expired early or was revoked. Logging in again renews
+		// it for the other collectors of the client as well.
+		res.Body.Close()
+		log.WithField("url", url).Debug("token rejected, logging in again")
+		httpClient.invalidateToken(req.Header.Get("Authorization"))
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.Header.Set("Authorization", authToken(httpClient))
+		res, err = httpClient.Do(req)
+	}
+	if err == nil && res.StatusCode == http.StatusUnauthorized && auth.digest {
+		// Answer the challenge of the server, which takes sending the
+		// request once more.
+		authorization, ok := digestAuthorization(res, method, req.URL.RequestURI(), auth.username, auth.password)
+		if ok {
+			res.Body.Close()
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			req.Header.Set("Authorization", authorization)
+			res, err = httpClient.Do(req)
+		}
+	}
 	if err != nil {
+		if location, ok := redirectLocation(err); ok {
+			log.WithFields(log.Fields{
+				"url":      url,
+				"location": location,
+			}).Error("Unexpected redirect")
+			errorCounter.WithLabelValues(endpoint, "redirect").Inc()
+			return false, false
+		}
 		log.WithFields(log.Fields{
 			"url":   url,
 			"error": err,
 		}).Error("Error fetching URL")
-		errorCounter.Inc()
-		return false
+		errorCounter.WithLabelValues(endpoint, "fetch").Inc()
+		return false, false
 	}
 	defer res.Body.Close()
+	if clockSkew != nil {
+		setClockSkew(clockSkew, res.Header.Get("Date"), time.Now())
+	}
 
-	if err := json.NewDecoder(res.Body).Decode(&target); err != nil {
+	if res.StatusCode == http.StatusNotFound && path == endpoint && optionalEndpoints[endpoint] {
+		log.WithField("url", url).Debug("optional endpoint not found")
+		return true, false
+	}
+
+	// Refuse a response known to be too large before reading any of it,
+	// and bound what is read of others once decoded, so that neither the
+	// decoders nor the salvaging of /state buffer more than the limit.
+	if limit := httpClient.maxResponseBytes; limit > 0 && res.ContentLength > limit {
+		httpClient.responseTooLarge(url, endpoint)
+		return false, false
+	}
+	resBody := io.Reader(res.Body)
+	if httpClient.acceptZstd {
+		decoded, err := decodeBody(res)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"url":   url,
+				"error": err,
+			}).Error("Error decoding response encoding")
+			errorCounter.WithLabelValues(endpoint, "encoding").Inc()
+			return false, false
+		}
+		defer decoded.Close()
+		resBody = decoded
+	}
+	if limit := httpClient.maxResponseBytes; limit > 0 {
+		resBody = &limitedReader{resBody, limit}
+	}
+	peeked := bufio.NewReaderSize(resBody, bodySnippetBytes)
+	if head, _ := peeked.Peek(bodySnippetBytes); notJSON(res.Header.Get("Content-Type"), head) {
 		log.WithFields(log.Fields{
+			"url":          url,
+			"status":       res.StatusCode,
+			"content_type": res.Header.Get("Content-Type"),
+			"body":         string(head),
+		}).Error("Response body is not JSON")
+		errorCounter.WithLabelValues(endpoint, "content-type").Inc()
+		return false, false
+	}
+	resBody = peeked
+
+	counted := &countingReader{r: resBody}
+	if httpClient.debugState != nil && path == "/state" {
+		// Keep what was received even if it fails to decode.
+		raw := httpClient.debugState.writer(baseURL)
+		counted.r = io.TeeReader(counted.r, raw)
+		defer func() { httpClient.debugState.store(baseURL, raw, time.Now()) }()
+	}
+	if httpClient.salvageTruncatedState && path == "/state" {
+		var fields int
+		if fields, err = decodeFields(counted, target); fields > 0 && truncated(err) {
+			log.WithFields(log.Fields{
+				"url":    url,
+				"fields": fields,
+				"error":  err,
+			}).Warn("Response body truncated, exporting the fields received")
+			errorCounter.WithLabelValues(endpoint, "truncated").Inc()
+			err = nil
+			partial = true
+		}
+	} else {
+		err = json.NewDecoder(counted).Decode(&target)
+	}
+	if err != nil {
+		if err == errResponseTooLarge {
+			httpClient.responseTooLarge(url, endpoint)
+			return false, false
+		}
+		// Tell malformed responses apart from changes of the schema.
+		fields := log.Fields{
 			"url":   url,
 			"error": err,
-		}).Error("Error decoding response body")
-		errorCounter.Inc()
-		return false
+		}
+		kind := "decode"
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			fields["offset"] = err.Offset
+			kind = "syntax"
+		case *json.UnmarshalTypeError:
+			fields["offset"] = err.Offset
+			fields["field"] = err.Field
+			kind = "type"
+		}
+		log.WithFields(fields).Error("Error decoding response body")
+		errorCounter.WithLabelValues(endpoint, kind).Inc()
+		return false, false
 	}
+	httpClient.metrics.setResponseBytes(endpoint, counted.n)
 
-	return true
+	return true, partial
 }
 
-func (c *metricCollector) Collect(ch chan<- prometheus.Metric) {
+// snapshot fetches /metrics/snapshot, handling an empty snapshot as
+// configured by retryEmptySnapshot and keepLastSnapshot.
+func (c *metricCollector) snapshot() metricMap {
 	var m metricMap
-	c.fetchAndDecode("/metrics/snapshot", &m)
+	ok := c.fetchAndDecode("/metrics/snapshot", &m)
+	if ok && len(m) == 0 && c.retryEmptySnapshot {
+		log.Debug("empty metrics snapshot, fetching it again")
+		ok = c.fetchAndDecode("/metrics/snapshot", &m)
+	}
+	if !c.keepLastSnapshot || !ok {
+		return m
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(m) == 0 {
+		log.Debug("empty metrics snapshot, exporting the last one")
+		return c.last
+	}
+	c.last = m
+	return m
+}
+
+func (c *metricCollector) Collect(ch chan<- prometheus.Metric) {
+	m := c.snapshot()
 	for cm, f := range c.metrics {
-		if err := f(m, cm); err != nil {
-			ch := make(chan *prometheus.Desc, 1)
+		// Counters are set anew from every snapshot.
+		if vec, ok := cm.(*settableCounterVec); ok {
+			vec.Reset()
+		}
+		if err := f(m, cm); err == errOptionalKeyMissing {
+			continue
+		} else if err != nil {
 			log.WithFields(log.Fields{
-				"metric": <-ch,
+				"metric": describe(cm),
 				"error":  err,
 			}).Error("Error extracting metric")
-			errorCounter.Inc()
+			errorCounter.WithLabelValues("/metrics/snapshot", "extract").Inc()
 			continue
 		}
 		cm.Collect(ch)
@@ -380,6 +1112,20 @@ func (c *metricCollector) Describe(ch chan<- *prometheus.Desc) {
 	}
 }
 
+// describe returns the descriptions of c, to tell it in logs.
+func describe(c prometheus.Collector) string {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	var descs []string
+	for desc := range ch {
+		descs = append(descs, desc.String())
+	}
+	return strings.Join(descs, ", ")
+}
+
 var invalidLabelNameCharRE = regexp.MustCompile("(^[^a-zA-Z_])|([^a-zA-Z0-9_])")
 
 // Sanitize label names according to https://prometheus.io/docs/concepts/data_model/
@@ -387,6 +1133,39 @@ func normaliseLabel(label string) string {
 	return invalidLabelNameCharRE.ReplaceAllString(label, "_")
 }
 
+// sanitiseLabelValue replaces invalid UTF-8 in a label value, which would
+// fail the whole scrape, with the Unicode replacement character.
+func sanitiseLabelValue(value string) string {
+	return strings.ToValidUTF8(value, "\uFFFD")
+}
+
+// parentRole returns the role a hierarchical role is nested in, eng for
+// eng/team-a, or "" for a top-level role.
+func parentRole(role string) string {
+	if i := strings.LastIndex(role, "/"); i >= 0 {
+		return role[:i]
+	}
+	return ""
+}
+
+// roleLabels returns the labels of a metric by role, with parent_role last
+// if parentRoleLabel is set.
+func (opts collectorOptions) roleLabels(labels ...string) []string {
+	if opts.parentRoleLabel {
+		return append(labels, "parent_role")
+	}
+	return labels
+}
+
+// roleLabelValues returns the label values of a metric by role for the
+// labels given to roleLabels.
+func (opts collectorOptions) roleLabelValues(role string, values ...string) []string {
+	if opts.parentRoleLabel {
+		return append(values, parentRole(role))
+	}
+	return values
+}
+
 func normaliseLabelList(labelList []string) []string {
 	normalisedLabelList := []string{}
 	for _, label := range labelList {
@@ -427,3 +1206,29 @@ func attributeString(attribute json.RawMessage) (string, error) {
 	}
 	return "", errDropAttribute
 }
+
+// attributeLabels fills labels with the attributes whose normalised names
+// are listed in normalisedAttributeLabels. Listed attributes the slave lacks,
+// or whose values are neither scalar nor text, get an empty value and the
+// latter are counted as dropped.
+func attributeLabels(labels prometheus.Labels, attributes map[string]json.RawMessage, normalisedAttributeLabels []string) {
+	for _, label := range normalisedAttributeLabels {
+		labels[label] = ""
+	}
+	for key, value := range attributes {
+		normalisedLabel := normaliseLabel(key)
+		if stringInSlice(normalisedLabel, normalisedAttributeLabels) {
+			attribute, err := attributeString(value)
+			if err != nil {
+				// Ranges and sets, such as [1-2], aren't JSON.
+				reason := "not_text"
+				if !json.Valid(value) {
+					reason = "unparseable"
+				}
+				droppedAttributes.WithLabelValues(reason).Inc()
+				continue
+			}
+			labels[normalisedLabel] = sanitiseLabelValue(attribute)
+		}
+	}
+}
@@ -2,9 +2,32 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
+// fakeFetcher serves canned JSON responses by endpoint. Fetching any other
+// endpoint fails.
+type fakeFetcher map[string]string
+
+func (f fakeFetcher) fetchAndDecode(endpoint string, target interface{}) bool {
+	data, ok := f[endpoint]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal([]byte(data), target) == nil
+}
+
 func Example_attributeString() {
 	tests := []string{
 		`"text"`,
@@ -24,3 +47,508 @@ func Example_attributeString() {
 	//  value neither scalar nor text
 	//  value neither scalar nor text
 }
+
+func TestLimitedReader(t *testing.T) {
+	for i, tt := range []struct {
+		body  string
+		limit int64
+		err   error
+	}{
+		{"1234", 5, nil},
+		{"12345", 5, nil},
+		{"123456", 5, errResponseTooLarge},
+	} {
+		_, err := ioutil.ReadAll(&limitedReader{strings.NewReader(tt.body), tt.limit})
+		if err != tt.err {
+			t.Errorf("test #%d: got err: %v, want: %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestFetchAndDecode_OptionalEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	client := &httpClient{Client: *srv.Client(), url: srv.URL}
+
+	var vf versionFields
+	if !client.fetchAndDecode("/version", &vf) {
+		t.Error("got a failure for a missing /version, want success")
+	}
+	if vf.Version != "" {
+		t.Errorf("got version %q, want none", vf.Version)
+	}
+
+	var m metricMap
+	if client.fetchAndDecode("/metrics/snapshot", &m) {
+		t.Error("got success for a missing /metrics/snapshot, want failure")
+	}
+}
+
+func TestFetchAndDecode_ClockSkew(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		w.Write([]byte(`{"version": "1.7.2"}`))
+	}))
+	defer srv.Close()
+	for _, master := range []bool{true, false} {
+		metrics, err := newTargetMetrics(prometheus.NewRegistry(), master)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &httpClient{Client: *srv.Client(), url: srv.URL, metrics: metrics}
+
+		if !client.fetchAndDecode("/version", &versionFields{}) {
+			t.Fatal("got a failure fetching /version")
+		}
+		if !master {
+			if metrics.masterClockSkew() != nil {
+				t.Error("got a clock skew for an agent")
+			}
+			continue
+		}
+		var pb dto.Metric
+		metrics.clockSkew.Write(&pb)
+		if got := pb.GetGauge().GetValue(); got < 58 || got > 62 {
+			t.Errorf("got skew %v, want about 60", got)
+		}
+	}
+}
+
+func TestFetchAndDecode_LastScrapeSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"version": "1.7.2"}`))
+	}))
+	defer srv.Close()
+	metrics, err := newTargetMetrics(prometheus.NewRegistry(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &httpClient{Client: *srv.Client(), url: srv.URL, metrics: metrics}
+
+	before := float64(time.Now().Unix())
+	client.fetchAndDecode("/version", &versionFields{})
+	client.fetchAndDecode("/state", &state{})
+
+	var pb dto.Metric
+	metrics.lastScrapeSuccess.WithLabelValues("/version").Write(&pb)
+	if got := pb.GetGauge().GetValue(); got < before {
+		t.Errorf("got /version success at %v, want at least %v", got, before)
+	}
+	metrics.lastScrapeSuccess.WithLabelValues("/state").Write(&pb)
+	if got := pb.GetGauge().GetValue(); got != 0 {
+		t.Errorf("got /state success at %v, want never", got)
+	}
+}
+
+func TestFetchAndDecode_InflightRequests(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		w.Write([]byte(`{"version": "1.7.2"}`))
+	}))
+	defer srv.Close()
+	client := &httpClient{Client: *srv.Client(), url: srv.URL}
+
+	inflight := func() float64 {
+		var pb dto.Metric
+		inflightRequestsGauge.Write(&pb)
+		return pb.GetGauge().GetValue()
+	}
+	done := make(chan bool)
+	go func() {
+		done <- client.fetchAndDecode("/version", &versionFields{})
+	}()
+	<-received
+	if got := inflight(); got != 1 {
+		t.Errorf("got %v inflight requests while fetching, want 1", got)
+	}
+	close(release)
+	if !<-done {
+		t.Fatal("got a failure fetching /version")
+	}
+	if got := inflight(); got != 0 {
+		t.Errorf("got %v inflight requests after fetching, want 0", got)
+	}
+}
+
+func TestSetClockSkew(t *testing.T) {
+	received := time.Date(2019, 5, 2, 18, 38, 30, 0, time.UTC)
+	for _, tt := range []struct {
+		date string
+		want float64
+	}{
+		{"Thu, 02 May 2019 18:38:30 GMT", 0.5},
+		{"Thu, 02 May 2019 18:38:20 GMT", -9.5},
+		{"yesterday", 42},
+		{"", 42},
+	} {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "skew"})
+		g.Set(42)
+		setClockSkew(g, tt.date, received)
+		var pb dto.Metric
+		g.Write(&pb)
+		if got := pb.GetGauge().GetValue(); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestAttributeLabels(t *testing.T) {
+	labels := prometheus.Labels{"id": "a1"}
+	attributeLabels(labels, map[string]json.RawMessage{
+		"rack-id": json.RawMessage(`"r1"`),
+		"gen":     json.RawMessage(`2`),
+		"ports":   json.RawMessage(`"[1-2]"`),
+		"other":   json.RawMessage(`"x"`),
+	}, []string{"rack_id", "gen", "ports", "zone"})
+
+	want := prometheus.Labels{"id": "a1", "rack_id": "r1", "gen": "2", "ports": "", "zone": ""}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("got: %v, want: %v", labels, want)
+	}
+}
+
+func TestAttributeLabels_Dropped(t *testing.T) {
+	droppedAttributes.Reset()
+	defer droppedAttributes.Reset()
+	attributeLabels(prometheus.Labels{}, map[string]json.RawMessage{
+		"rack":  json.RawMessage(`"r1"`),
+		"ports": json.RawMessage(`[1-2]`),
+		"disks": json.RawMessage(`{"a": "b"}`),
+		"zone":  json.RawMessage(`"a b"`),
+		"other": json.RawMessage(`{"c": "d"}`),
+	}, []string{"rack", "ports", "disks", "zone"})
+
+	for reason, want := range map[string]float64{"not_text": 2, "unparseable": 1} {
+		var pb dto.Metric
+		droppedAttributes.WithLabelValues(reason).Write(&pb)
+		if got := pb.GetCounter().GetValue(); got != want {
+			t.Errorf("%s: got %v, want %v", reason, got, want)
+		}
+	}
+}
+
+func TestTimedCollector(t *testing.T) {
+	c := newTimedCollector("test", newGroupedCollector())
+	for i, want := range []int{0, 1} {
+		ch := make(chan prometheus.Metric, 1)
+		c.Collect(ch)
+		close(ch)
+		if got := len(ch); got != want {
+			t.Errorf("collection #%d: got %d metrics, want %d", i, got, want)
+		}
+	}
+}
+
+func TestFetchAndDecode_DecodeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		kind string
+	}{
+		{`{"slaves": [`, "decode"},
+		{`{"slaves": [}`, "syntax"},
+		{`{"slaves": [{"hostname": 1}]}`, "type"},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tt.body))
+		}))
+		client := &httpClient{Client: *srv.Client(), url: srv.URL}
+
+		before := collectMetrics(errorCounter.WithLabelValues("/state", tt.kind))[0].GetCounter().GetValue()
+		var s state
+		if client.fetchAndDecode("/state", &s) {
+			t.Errorf("%s: got success", tt.body)
+		}
+		if got := collectMetrics(errorCounter.WithLabelValues("/state", tt.kind))[0].GetCounter().GetValue(); got != before+1 {
+			t.Errorf("%s: %s errors went from %v to %v, want one more", tt.body, tt.kind, before, got)
+		}
+		srv.Close()
+	}
+}
+
+func TestFetchAndDecode_TooLarge(t *testing.T) {
+	large := `{"slaves": [{"pid": "s1"}], "frameworks": [` + strings.Repeat(`{"id": "f1"},`, 100) + `{"id": "f1"}]}`
+	for _, tt := range []struct {
+		name          string
+		contentLength int
+		body          string
+	}{
+		// Only the start of the body is sent, which is never read as its
+		// length is known to exceed the limit.
+		{"declared", 1 << 30, `{"slaves": [`},
+		// Without a length, reading stops at the limit, salvaging or not.
+		{"chunked", -1, large},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.contentLength >= 0 {
+				w.Header().Set("Content-Length", fmt.Sprint(tt.contentLength))
+			}
+			w.Write([]byte(tt.body))
+		}))
+		for _, salvage := range []bool{false, true} {
+			client := &httpClient{Client: *srv.Client(), url: srv.URL, maxResponseBytes: 64, salvageTruncatedState: salvage}
+			before := collectMetrics(errorCounter.WithLabelValues("/state", "too_large"))[0].GetCounter().GetValue()
+			var s state
+			if client.fetchAndDecode("/state", &s) {
+				t.Errorf("%s, salvage=%v: got success", tt.name, salvage)
+			}
+			if got := collectMetrics(errorCounter.WithLabelValues("/state", "too_large"))[0].GetCounter().GetValue(); got != before+1 {
+				t.Errorf("%s, salvage=%v: too_large errors went from %v to %v, want one more", tt.name, salvage, before, got)
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestFetchAndDecode_NotJSON(t *testing.T) {
+	for _, tt := range []struct {
+		contentType string
+		body        string
+		ok          bool
+	}{
+		{"text/html", "<html><body><h1>502 Bad Gateway</h1></body></html>", false},
+		{"", "<!DOCTYPE html>\n<html></html>", false},
+		{"text/plain", `{"elected_time": 1}`, true},
+		{"application/json; charset=utf-8", `{"elected_time": 1}`, true},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			w.Write([]byte(tt.body))
+		}))
+		client := &httpClient{Client: *srv.Client(), url: srv.URL}
+
+		before := collectMetrics(errorCounter.WithLabelValues("/metrics/snapshot", "content-type"))[0].GetCounter().GetValue()
+		var m metricMap
+		if ok := client.fetchAndDecode("/metrics/snapshot", &m); ok != tt.ok {
+			t.Errorf("%s: got ok %v, want %v", tt.contentType, ok, tt.ok)
+		}
+		want := before
+		if !tt.ok {
+			want++
+		}
+		if got := collectMetrics(errorCounter.WithLabelValues("/metrics/snapshot", "content-type"))[0].GetCounter().GetValue(); got != want {
+			t.Errorf("%s: got %v content-type errors, want %v", tt.contentType, got, want)
+		}
+		srv.Close()
+	}
+}
+
+func TestVersionCollector(t *testing.T) {
+	for _, tt := range []struct {
+		fetcher fakeFetcher
+		want    map[string]string
+	}{
+		{fakeFetcher{"/version": `{"version": "1.7.2", "git_sha": "58cc918", "build_time": 1556822310}`},
+			map[string]string{"version": "1.7.2", "git_sha": "58cc918", "build_time": "1556822310.000000"}},
+		{fakeFetcher{"/version": `{}`}, nil},
+		{fakeFetcher{}, nil},
+	} {
+		ms := collectMetrics(newVersionCollector(tt.fetcher, collectorOptions{}))
+		if tt.want == nil {
+			if len(ms) != 0 {
+				t.Errorf("%v: got %d metrics, want none", tt.fetcher, len(ms))
+			}
+			continue
+		}
+		if len(ms) != 1 {
+			t.Fatalf("%v: got %d metrics, want 1", tt.fetcher, len(ms))
+		}
+		for name, want := range tt.want {
+			if got := labelValue(ms[0], name); got != want {
+				t.Errorf("%v: got %s %q, want %q", tt.fetcher, name, got, want)
+			}
+		}
+	}
+}
+
+func TestBuildTimeFormats(t *testing.T) {
+	for format, want := range map[string]string{
+		"float":   "1556822310.000000",
+		"rfc3339": "2019-05-02T18:38:30Z",
+	} {
+		if got := buildTimeFormats[format](1556822310); got != want {
+			t.Errorf("%s: got %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestSettableCounterVec(t *testing.T) {
+	c := counter("master", "tasks", "Total number of tasks", "state")
+	c.Set(1, "finished")
+	c.Set(2, "finished")
+	c.Set(3, "failed")
+
+	want := map[string]float64{"finished": 2, "failed": 3}
+	for i := 0; i < 2; i++ {
+		got := map[string]float64{}
+		for _, m := range collectMetrics(c) {
+			got[labelValue(m, "state")] = m.GetCounter().GetValue()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("collect #%d: got: %v, want: %v", i, got, want)
+		}
+	}
+
+	c.Reset()
+	if ms := collectMetrics(c); len(ms) != 0 {
+		t.Errorf("got %d metrics after Reset, want none", len(ms))
+	}
+}
+
+func TestMetricCollector(t *testing.T) {
+	c := newMasterCollector(fakeFetcher{
+		"/metrics/snapshot": `{"master/elected": 1, "master/uptime_secs": 120}`,
+	}, collectorOptions{})
+	got := gatherByName(c, "mesos_master_elected", "mesos_master_uptime_seconds")
+	want := map[string]float64{"mesos_master_elected": 1, "mesos_master_uptime_seconds": 120}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+// snapshotsFetcher serves the given snapshots in turn, the last one for
+// every later fetch.
+type snapshotsFetcher []string
+
+func (f *snapshotsFetcher) fetchAndDecode(endpoint string, target interface{}) bool {
+	if endpoint != "/metrics/snapshot" {
+		return false
+	}
+	data := (*f)[0]
+	if len(*f) > 1 {
+		*f = (*f)[1:]
+	}
+	return json.Unmarshal([]byte(data), target) == nil
+}
+
+func TestMetricCollector_EmptySnapshot(t *testing.T) {
+	exported := func(c prometheus.Collector) bool {
+		_, ok := gatherByName(c, "mesos_master_elected")["mesos_master_elected"]
+		return ok
+	}
+
+	for _, tt := range []struct {
+		retry, keep bool
+		snapshots   []string
+		want        []bool
+	}{
+		{false, false, []string{`{}`, `{"master/elected": 1}`}, []bool{false, true}},
+		{true, false, []string{`{}`, `{"master/elected": 1}`}, []bool{true, true}},
+		{false, true, []string{`{"master/elected": 1}`, `{}`, `{}`}, []bool{true, true, true}},
+		{false, false, []string{`{"master/elected": 1}`, `{}`}, []bool{true, false}},
+	} {
+		f := snapshotsFetcher(tt.snapshots)
+		c := newMetricCollector(&f, map[prometheus.Collector]metricsCollectorFunctor{
+			gauge("master", "elected", "1 if master is elected leader, 0 if not"): func(m metricMap, c prometheus.Collector) error {
+				elected, ok := m["master/elected"]
+				if !ok {
+					return errOptionalKeyMissing
+				}
+				c.(*prometheus.GaugeVec).WithLabelValues().Set(elected)
+				return nil
+			},
+		}, collectorOptions{retryEmptySnapshot: tt.retry, keepLastSnapshot: tt.keep})
+		for i, want := range tt.want {
+			if got := exported(c); got != want {
+				t.Errorf("retry=%v keep=%v scrape #%d: got elected exported %v, want %v", tt.retry, tt.keep, i, got, want)
+			}
+		}
+	}
+}
+
+func TestMetricCollector_ExtractError(t *testing.T) {
+	c := newMetricCollector(fakeFetcher{"/metrics/snapshot": `{"master/elected": 1}`}, map[prometheus.Collector]metricsCollectorFunctor{
+		gauge("master", "elected", "1 if master is elected leader, 0 if not"): func(m metricMap, c prometheus.Collector) error {
+			return errors.New("broken")
+		},
+	}, collectorOptions{})
+	before := collectMetrics(errorCounter.WithLabelValues("/metrics/snapshot", "extract"))[0].GetCounter().GetValue()
+	done := make(chan map[string]float64)
+	go func() {
+		done <- gatherByName(c, "mesos_master_elected")
+	}()
+	select {
+	case got := <-done:
+		if len(got) != 0 {
+			t.Errorf("got %v, want nothing exported", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("collect blocked on a metric failing to extract")
+	}
+	if got := collectMetrics(errorCounter.WithLabelValues("/metrics/snapshot", "extract"))[0].GetCounter().GetValue(); got != before+1 {
+		t.Errorf("got %v extract errors, want %v", got, before+1)
+	}
+}
+
+func TestMasterCollector_Messages(t *testing.T) {
+	c := newMasterCollector(fakeFetcher{
+		"/metrics/snapshot": `{"master/messages_launch_tasks": 5, "master/messages_operation_status_update_acknowledgement": 2, "master/dropped_messages": 1}`,
+	}, collectorOptions{})
+	got := gatherByName(c, "mesos_master_messages_total{type}")
+	want := map[string]float64{
+		"mesos_master_messages_total{launch_tasks}":                            5,
+		"mesos_master_messages_total{operation_status_update_acknowledgement}": 2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_HierarchicalRoles(t *testing.T) {
+	c := newMasterCollector(fakeFetcher{
+		"/metrics/snapshot": `{"allocator/mesos/roles/eng/team-a/shares/dominant": 0.5, "allocator/mesos/roles/web/shares/dominant": 0.25}`,
+	}, collectorOptions{})
+	got := gatherByName(c, "mesos_master_allocator_role_shares_dominant{role}")
+	want := map[string]float64{
+		"mesos_master_allocator_role_shares_dominant{eng/team-a}": 0.5,
+		"mesos_master_allocator_role_shares_dominant{web}":        0.25,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_OfferDeclineRatio(t *testing.T) {
+	c := newMasterCollector(fakeFetcher{
+		"/metrics/snapshot": `{
+  "master/frameworks/marathon/f1/offers/accepted": 1,
+  "master/frameworks/marathon/f1/offers/declined": 3,
+  "master/frameworks/idle/f2/offers/accepted": 0,
+  "master/frameworks/idle/f2/offers/declined": 0
+}`,
+	}, collectorOptions{})
+	got := gatherByName(c, "mesos_framework_offer_decline_ratio{framework_id}")
+	want := map[string]float64{"mesos_framework_offer_decline_ratio{f1}": 0.75}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMetricCollector_OptionalKeys(t *testing.T) {
+	c := newMasterCollector(fakeFetcher{
+		"/metrics/snapshot": `{"master/slaves_active": 3}`,
+	}, collectorOptions{})
+	got := gatherByName(c, "mesos_master_slaves_active", "mesos_master_slaves_inactive", "mesos_master_slaves_disconnected")
+	want := map[string]float64{"mesos_master_slaves_active": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMetricMap_UnmarshalJSON(t *testing.T) {
+	var got metricMap
+	data := `{"master/elected": 1, "master/uptime_secs": "120.5", "master/version": "1.7.2", "master/mem_used": null}`
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := metricMap{"master/elected": 1, "master/uptime_secs": 120.5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateCache keeps the last raw v0 /state response fetched from every master,
+// to be served on /debug/state for reproducing decode issues without access
+// to the master.
+type stateCache struct {
+	// max is the number of bytes of a response kept
+	max int
+
+	mu sync.Mutex
+	// states are the responses by the URL of the master they came from
+	states map[string]*cachedState
+}
+
+type cachedState struct {
+	body      []byte
+	truncated bool
+	fetched   time.Time
+	// spare is the buffer of the response replaced last, which the next
+	// response is copied into
+	spare []byte
+}
+
+func newStateCache(max int) *stateCache {
+	return &stateCache{max: max, states: map[string]*cachedState{}}
+}
+
+// writer returns a writer the response of master is copied into as it is
+// read, which keeps up to max bytes and discards the rest.
+func (c *stateCache) writer(master string) *cappedBuffer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := &cappedBuffer{max: c.max}
+	if s, ok := c.states[master]; ok {
+		b.buf, s.spare = s.spare[:0], nil
+	}
+	return b
+}
+
+// store replaces the cached response of master with the one copied into b.
+func (c *stateCache) store(master string, b *cappedBuffer, fetched time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.states[master]
+	if !ok {
+		s = &cachedState{}
+		c.states[master] = s
+	}
+	s.spare = s.body
+	s.body = b.buf
+	s.truncated = b.truncated
+	s.fetched = fetched
+}
+
+// ServeHTTP serves the response of the master given by the master
+// parameter, which may be left out if only one master was fetched.
+func (c *stateCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	master := r.URL.Query().Get("master")
+	c.mu.Lock()
+	if master == "" && len(c.states) > 1 {
+		masters := make([]string, 0, len(c.states))
+		for m := range c.states {
+			masters = append(masters, m)
+		}
+		c.mu.Unlock()
+		sort.Strings(masters)
+		http.Error(w, "several masters fetched, give one as master parameter: "+strings.Join(masters, ", "), http.StatusBadRequest)
+		return
+	}
+	s := c.states[master]
+	if master == "" {
+		for _, only := range c.states {
+			s = only
+		}
+	}
+	if s == nil {
+		c.mu.Unlock()
+		http.Error(w, "/state not fetched yet", http.StatusNotFound)
+		return
+	}
+	// The buffer is reused once the next response is stored.
+	body := append([]byte(nil), s.body...)
+	truncated, fetched := s.truncated, s.fetched
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Last-Modified", fetched.UTC().Format(http.TimeFormat))
+	w.Header().Set("X-Truncated", strconv.FormatBool(truncated))
+	w.Write(body)
+}
+
+// cappedBuffer keeps the first max bytes written to it.
+type cappedBuffer struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - len(b.buf); n > room {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
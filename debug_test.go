@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStateCache(t *testing.T) {
+	const body = `{"hostname": "master", "slaves": [}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		max       int
+		want      string
+		truncated string
+	}{
+		{1024, body, "false"},
+		{12, body[:12], "true"},
+	} {
+		cache := newStateCache(tt.max)
+		rec := httptest.NewRecorder()
+		cache.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/state", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("got status %d before fetching, want 404", rec.Code)
+		}
+
+		// The response is kept although it fails to decode.
+		client := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, debugState: cache}, authInfo{}, nil, nil)
+		var s state
+		client.fetchAndDecode("/state", &s)
+
+		rec = httptest.NewRecorder()
+		cache.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/state", nil))
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("max %d: got %q, want %q", tt.max, got, tt.want)
+		}
+		if got := rec.Header().Get("X-Truncated"); got != tt.truncated {
+			t.Errorf("max %d: got X-Truncated %s, want %s", tt.max, got, tt.truncated)
+		}
+	}
+}
+
+func TestStateCache_Masters(t *testing.T) {
+	newMaster := func(hostname string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"hostname": "` + hostname + `"}`))
+		}))
+	}
+	first := newMaster("first")
+	defer first.Close()
+	second := newMaster("second")
+	defer second.Close()
+
+	cache := newStateCache(1024)
+	for _, ts := range []*httptest.Server{first, second} {
+		client := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, debugState: cache}, authInfo{}, nil, nil)
+		var s state
+		client.fetchAndDecode("/state", &s)
+		// Responses of the v1 API aren't kept.
+		client.apiVersion = "v1"
+		client.fetchAndDecode("/state", &s)
+	}
+
+	for _, tt := range []struct {
+		master string
+		code   int
+		want   string
+	}{
+		{"", http.StatusBadRequest, ""},
+		{first.URL, http.StatusOK, `{"hostname": "first"}`},
+		{second.URL, http.StatusOK, `{"hostname": "second"}`},
+		{"http://other:5050", http.StatusNotFound, ""},
+	} {
+		rec := httptest.NewRecorder()
+		cache.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/state?master="+tt.master, nil))
+		if rec.Code != tt.code {
+			t.Errorf("master %q: got status %d, want %d", tt.master, rec.Code, tt.code)
+		}
+		if got := rec.Body.String(); tt.code == http.StatusOK && got != tt.want {
+			t.Errorf("master %q: got %q, want %q", tt.master, got, tt.want)
+		}
+	}
+}
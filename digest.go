@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// digestParams parses the parameters of a Digest challenge or
+// authorization, such as `Digest realm="mesos", nonce="abc", qop="auth"`.
+// ok is false if it isn't one.
+func digestParams(header string) (params map[string]string, ok bool) {
+	const prefix = "digest "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, false
+	}
+	params = map[string]string{}
+	s := strings.TrimSpace(header[len(prefix):])
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimSpace(s[eq+1:])
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+		s = strings.TrimLeft(s, ", ")
+	}
+	return params, true
+}
+
+// digestAuthorization answers the Digest challenge among the
+// WWW-Authenticate headers of res for a request of method to uri. ok is
+// false if there's no challenge it can answer.
+func digestAuthorization(res *http.Response, method, uri, username, password string) (authorization string, ok bool) {
+	var challenge map[string]string
+	for _, header := range res.Header["Www-Authenticate"] {
+		if challenge, ok = digestParams(header); ok {
+			break
+		}
+	}
+	if !ok {
+		return "", false
+	}
+
+	var newHash func() hash.Hash
+	algorithm := challenge["algorithm"]
+	upper := strings.ToUpper(algorithm)
+	switch strings.TrimSuffix(upper, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", false
+	}
+	h := func(parts ...string) string {
+		d := newHash()
+		d.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	realm, nonce := challenge["realm"], challenge["nonce"]
+	cnonce := make([]byte, 8)
+	if _, err := rand.Read(cnonce); err != nil {
+		return "", false
+	}
+	cn := hex.EncodeToString(cnonce)
+	ha1 := h(username, realm, password)
+	if strings.HasSuffix(upper, "-SESS") {
+		ha1 = h(ha1, nonce, cn)
+	}
+	ha2 := h(method, uri)
+
+	// Every request answers a challenge of its own, so the nonce is only
+	// ever used once.
+	const nc = "00000001"
+	qop := ""
+	for _, q := range strings.Split(challenge["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	fields := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if qop != "" {
+		fields = append(fields,
+			"qop="+qop,
+			"nc="+nc,
+			fmt.Sprintf("cnonce=%q", cn),
+			fmt.Sprintf("response=%q", h(ha1, nonce, nc, cn, qop, ha2)))
+	} else {
+		fields = append(fields, fmt.Sprintf("response=%q", h(ha1, nonce, ha2)))
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		fields = append(fields, fmt.Sprintf("opaque=%q", opaque))
+	}
+	if algorithm != "" {
+		fields = append(fields, "algorithm="+algorithm)
+	}
+	return "Digest " + strings.Join(fields, ", "), true
+}
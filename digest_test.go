@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDigestParams(t *testing.T) {
+	for header, want := range map[string]map[string]string{
+		`Digest realm="mesos", nonce="abc", qop="auth,auth-int", opaque="x"`: {"realm": "mesos", "nonce": "abc", "qop": "auth,auth-int", "opaque": "x"},
+		`digest realm="a \"quoted\" realm",algorithm=MD5-sess`:               {"realm": `a "quoted" realm`, "algorithm": "MD5-sess"},
+		`Basic realm="mesos"`: nil,
+	} {
+		got, ok := digestParams(header)
+		if ok != (want != nil) || (ok && !reflect.DeepEqual(got, want)) {
+			t.Errorf("%s: got %v, %v, want %v", header, got, ok, want)
+		}
+	}
+}
+
+func TestRequest_DigestAuth(t *testing.T) {
+	md5Hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	// The stub checks the response to its challenge as RFC 7616 tells.
+	challenges := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := digestParams(r.Header.Get("Authorization"))
+		if !ok {
+			challenges++
+			w.Header().Set("WWW-Authenticate", `Digest realm="mesos", nonce="n0nce", qop="auth", opaque="op"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ha1 := md5Hex("alice:mesos:secret")
+		ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+		want := md5Hex(fmt.Sprintf("%s:n0nce:%s:%s:auth:%s", ha1, p["nc"], p["cnonce"], ha2))
+		if p["username"] != "alice" || p["uri"] != r.URL.RequestURI() || p["opaque"] != "op" || p["response"] != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"version": "1.7.2"}`))
+	}))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		password string
+		ok       bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+	} {
+		auth := authInfo{username: "alice", password: tt.password, digest: true}
+		client := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second}, auth, nil, nil)
+		var vf versionFields
+		if ok := client.fetchAndDecode("/version", &vf); ok != tt.ok {
+			t.Errorf("password %s: got ok %v, want %v", tt.password, ok, tt.ok)
+		}
+	}
+	if challenges != 2 {
+		t.Errorf("got %d challenges, want 2", challenges)
+	}
+}
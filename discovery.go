@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// endpointList is a list of master base URLs which is kept up to date by a
+// discovery mechanism. Clients using it try the masters in order until one
+// of them answers.
+type endpointList struct {
+	sync.RWMutex
+	urls []string
+}
+
+func (l *endpointList) get() []string {
+	l.RLock()
+	defer l.RUnlock()
+	return l.urls
+}
+
+func (l *endpointList) set(urls []string) {
+	l.Lock()
+	defer l.Unlock()
+	l.urls = urls
+}
+
+// resolveSRV returns the base URLs of the targets of an SRV record. The
+// resolver already orders the targets by priority and randomizes them by
+// weight within each priority, as described in RFC 2782.
+func resolveSRV(record, scheme string) ([]string, error) {
+	_, addrs, err := net.LookupSRV("", "", record)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no targets for SRV record %s", record)
+	}
+
+	urls := []string{}
+	for _, addr := range addrs {
+		host := strings.TrimSuffix(addr.Target, ".")
+		urls = append(urls, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, fmt.Sprintf("%d", addr.Port))))
+	}
+	return urls, nil
+}
+
+// newSRVEndpoints resolves the SRV record once and then keeps re-resolving
+// it every refresh interval. A failed refresh keeps the previous list.
+func newSRVEndpoints(record, scheme string, refresh time.Duration) (*endpointList, error) {
+	urls, err := resolveSRV(record, scheme)
+	if err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"record":  record,
+		"masters": urls,
+	}).Debug("resolved masters")
+
+	l := &endpointList{urls: urls}
+	go func() {
+		for range time.Tick(refresh) {
+			urls, err := resolveSRV(record, scheme)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"record": record,
+					"error":  err,
+				}).Error("Error resolving SRV record")
+				errorCounter.WithLabelValues("", "discovery").Inc()
+				continue
+			}
+			l.set(urls)
+		}
+	}()
+	return l, nil
+}
+
+// parseZKURL splits a Mesos ZooKeeper URL of the form
+// zk://host1:2181,host2:2181/mesos into its servers and znode path.
+func parseZKURL(zkURL string) ([]string, string, error) {
+	if !strings.HasPrefix(zkURL, "zk://") {
+		return nil, "", fmt.Errorf("ZooKeeper URL must start with zk://: %s", zkURL)
+	}
+	rest := strings.TrimPrefix(zkURL, "zk://")
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return nil, "", fmt.Errorf("ZooKeeper URL needs both servers and a path: %s", zkURL)
+	}
+	return strings.Split(rest[:i], ","), strings.TrimSuffix(rest[i:], "/"), nil
+}
+
+// zkMasterInfo is the subset of the MasterInfo JSON stored by Mesos in the
+// json.info_* znodes.
+type zkMasterInfo struct {
+	Address struct {
+		Hostname string `json:"hostname"`
+		IP       string `json:"ip"`
+		Port     int    `json:"port"`
+	} `json:"address"`
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
+}
+
+// zkLeaderNode returns the znode of the elected master, which is the
+// json.info_* child with the lowest sequence number.
+func zkLeaderNode(children []string) (string, bool) {
+	leader := ""
+	for _, child := range children {
+		if !strings.HasPrefix(child, "json.info_") {
+			continue
+		}
+		// Sequence numbers are zero-padded, so they sort lexically.
+		if leader == "" || child < leader {
+			leader = child
+		}
+	}
+	return leader, leader != ""
+}
+
+func (info zkMasterInfo) url(scheme string) (string, error) {
+	host, port := info.Address.Hostname, info.Address.Port
+	if host == "" {
+		host = info.Address.IP
+	}
+	if host == "" {
+		host, port = info.Hostname, info.Port
+	}
+	if host == "" || port == 0 {
+		return "", fmt.Errorf("master info lacks an address")
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, fmt.Sprintf("%d", port))), nil
+}
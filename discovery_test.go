@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFetchAndDecode_Failover(t *testing.T) {
+	// The first master fails to decode after setting git_sha.
+	var fetched []string
+	newMaster := func(name, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetched = append(fetched, name)
+			w.Write([]byte(body))
+		}))
+	}
+	first := newMaster("first", `{"git_sha": "abc", "version": 1}`)
+	defer first.Close()
+	second := newMaster("second", `{"version": "1.7.2"}`)
+	defer second.Close()
+
+	client := mkHTTPClient("", httpOptions{}, authInfo{}, nil, nil)
+	client.failover = &endpointList{urls: []string{first.URL, second.URL}}
+
+	var vf versionFields
+	if !client.fetchAndDecode("/version", &vf) {
+		t.Fatal("got a failure failing over to the second master")
+	}
+	if want := (versionFields{Version: "1.7.2"}); vf != want {
+		t.Errorf("got %+v, want %+v", vf, want)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("got masters fetched %v, want %v", fetched, want)
+	}
+
+	// The first master answering is the only one fetched.
+	fetched = nil
+	client.failover.set([]string{second.URL, first.URL})
+	if !client.fetchAndDecode("/version", &vf) {
+		t.Fatal("got a failure fetching from the second master")
+	}
+	if want := []string{"second"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("got masters fetched %v, want %v", fetched, want)
+	}
+}
+
+func TestParseZKURL(t *testing.T) {
+	for i, tt := range []struct {
+		url     string
+		servers []string
+		path    string
+		err     bool
+	}{
+		{"zk://zk1:2181/mesos", []string{"zk1:2181"}, "/mesos", false},
+		{"zk://zk1:2181,zk2:2181/mesos/", []string{"zk1:2181", "zk2:2181"}, "/mesos", false},
+		{"zk://zk1:2181", nil, "", true},
+		{"http://zk1:2181/mesos", nil, "", true},
+	} {
+		servers, path, err := parseZKURL(tt.url)
+		if (err != nil) != tt.err {
+			t.Errorf("test #%d: got err: %v, want err: %v", i, err, tt.err)
+		}
+		if !reflect.DeepEqual(servers, tt.servers) || path != tt.path {
+			t.Errorf("test #%d: got: %v %q, want: %v %q", i, servers, path, tt.servers, tt.path)
+		}
+	}
+}
+
+func TestZKLeaderNode(t *testing.T) {
+	node, ok := zkLeaderNode([]string{"log_replicas", "json.info_0000000012", "json.info_0000000009"})
+	if !ok || node != "json.info_0000000009" {
+		t.Errorf("got: %q %v, want: json.info_0000000009 true", node, ok)
+	}
+	if _, ok := zkLeaderNode([]string{"log_replicas"}); ok {
+		t.Error("found a leader without json.info_ nodes")
+	}
+
+	var info zkMasterInfo
+	info.Address.Hostname = "master1"
+	info.Address.Port = 5050
+	if url, err := info.url("https"); err != nil || url != "https://master1:5050" {
+		t.Errorf("got: %q %v, want: https://master1:5050", url, err)
+	}
+}
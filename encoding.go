@@ -0,0 +1,43 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is sent by clients decoding responses themselves. The Go
+// transport only decodes gzip, and not at all once Accept-Encoding is set.
+const acceptEncoding = "zstd, gzip"
+
+// contentDecoders decode response bodies by their Content-Encoding.
+var contentDecoders = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+// decodeBody returns the body of res decoded according to its
+// Content-Encoding.
+func decodeBody(res *http.Response) (io.ReadCloser, error) {
+	encoding := res.Header.Get("Content-Encoding")
+	if encoding == "" || encoding == "identity" {
+		return ioutil.NopCloser(res.Body), nil
+	}
+	decoder, ok := contentDecoders[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	return decoder(res.Body)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFetchAndDecode_ContentEncoding(t *testing.T) {
+	for encoding, newWriter := range map[string]func(io.Writer) io.WriteCloser{
+		"zstd": func(w io.Writer) io.WriteCloser {
+			e, _ := zstd.NewWriter(w)
+			return e
+		},
+		"gzip": func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		"identity": nil,
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Accept-Encoding"); got != acceptEncoding {
+				t.Errorf("%s: got Accept-Encoding %q, want %q", encoding, got, acceptEncoding)
+			}
+			if newWriter == nil {
+				w.Write([]byte(`{"version": "1.7.2"}`))
+				return
+			}
+			w.Header().Set("Content-Encoding", encoding)
+			e := newWriter(w)
+			e.Write([]byte(`{"version": "1.7.2"}`))
+			e.Close()
+		}))
+
+		client := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, acceptZstd: true}, authInfo{}, nil, nil)
+		var vf versionFields
+		if !client.fetchAndDecode("/version", &vf) || vf.Version != "1.7.2" {
+			t.Errorf("%s: got version %q, want 1.7.2", encoding, vf.Version)
+		}
+		ts.Close()
+	}
+}
+
+func TestFetchAndDecode_ContentEncodingTooLarge(t *testing.T) {
+	// A few bytes of zstd decompress to far more than the limit.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd")
+		e, _ := zstd.NewWriter(w)
+		e.Write([]byte(`{"version": "` + strings.Repeat("1", 1<<20) + `"}`))
+		e.Close()
+	}))
+	defer ts.Close()
+
+	client := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, acceptZstd: true, maxResponseBytes: 1024}, authInfo{}, nil, nil)
+	before := collectMetrics(errorCounter.WithLabelValues("/version", "too_large"))[0].GetCounter().GetValue()
+	var vf versionFields
+	if client.fetchAndDecode("/version", &vf) {
+		t.Error("got success decoding a response larger than the limit once decompressed")
+	}
+	if got := collectMetrics(errorCounter.WithLabelValues("/version", "too_large"))[0].GetCounter().GetValue(); got != before+1 {
+		t.Errorf("too_large errors went from %v to %v, want one more", before, got)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+)
+
+// semaphore bounds the number of requests run in parallel by collectors that
+// fan out to many agents, so that a scrape doesn't flood the master. A
+// single semaphore is shared by all clients.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	return make(semaphore, n)
+}
+
+// forEach calls f for every index below n and waits for all calls to return.
+// The calls run in parallel, at most as many at a time as the semaphore
+// allows, or one after the other with a nil semaphore.
+func (s semaphore) forEach(n int, f func(i int)) {
+	if s == nil {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		s <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-s
+				wg.Done()
+			}()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
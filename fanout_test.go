@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSemaphore_ForEach(t *testing.T) {
+	for _, s := range []semaphore{nil, newSemaphore(1), newSemaphore(3)} {
+		var mu sync.Mutex
+		running, max := 0, 0
+		done := make([]bool, 10)
+		s.forEach(len(done), func(i int) {
+			mu.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+			done[i] = true
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+
+		limit := cap(s)
+		if s == nil {
+			limit = 1
+		}
+		if max > limit {
+			t.Errorf("limit %d: got %d calls in parallel", limit, max)
+		}
+		for i, ok := range done {
+			if !ok {
+				t.Errorf("limit %d: index %d was not done", limit, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// filteredGatherer leaves the metric families whose name doesn't match keep,
+// or does match drop, out of those gathered from the wrapped Gatherer. A nil
+// regexp doesn't filter. The collectors still fetch and compute the metrics
+// left out.
+type filteredGatherer struct {
+	prometheus.Gatherer
+	keep, drop *regexp.Regexp
+}
+
+// newFilteredGatherer wraps g, matching keep and drop against the whole
+// metric name. An empty expression doesn't filter.
+func newFilteredGatherer(g prometheus.Gatherer, keep, drop string) (prometheus.Gatherer, error) {
+	f := &filteredGatherer{Gatherer: g}
+	var err error
+	if keep != "" {
+		if f.keep, err = regexp.Compile("^(?:" + keep + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	if drop != "" {
+		if f.drop, err = regexp.Compile("^(?:" + drop + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (g *filteredGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	kept := mfs[:0]
+	for _, mf := range mfs {
+		if g.keep != nil && !g.keep.MatchString(mf.GetName()) {
+			continue
+		}
+		if g.drop != nil && g.drop.MatchString(mf.GetName()) {
+			continue
+		}
+		kept = append(kept, mf)
+	}
+	return kept, err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFilteredGatherer(t *testing.T) {
+	r := prometheus.NewRegistry()
+	for _, name := range []string{"mesos_up", "mesos_slave_cpus", "mesos_slave_mem_bytes", "mesos_exporter_last_response_bytes"} {
+		r.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: name}))
+	}
+
+	for _, tt := range []struct {
+		keep, drop string
+		want       []string
+	}{
+		{"", "", []string{"mesos_exporter_last_response_bytes", "mesos_slave_cpus", "mesos_slave_mem_bytes", "mesos_up"}},
+		{"mesos_slave_.*", "", []string{"mesos_slave_cpus", "mesos_slave_mem_bytes"}},
+		{"", "mesos_exporter_.*|mesos_up", []string{"mesos_slave_cpus", "mesos_slave_mem_bytes"}},
+		{"mesos_slave_.*", ".*_bytes", []string{"mesos_slave_cpus"}},
+		// Expressions match the whole name.
+		{"mesos_slave", "", nil},
+	} {
+		g, err := newFilteredGatherer(r, tt.keep, tt.drop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := g.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, mf := range mfs {
+			got = append(got, mf.GetName())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("keep %q, drop %q: got: %v, want: %v", tt.keep, tt.drop, got, tt.want)
+		}
+	}
+
+	if _, err := newFilteredGatherer(r, "(", ""); err == nil {
+		t.Error("got no error for an invalid expression")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fixtureFetcher reads the responses of a master from JSON files in a
+// directory instead of fetching them over HTTP, e.g. /metrics/snapshot
+// from metrics_snapshot.json. It serves demos, integration tests and
+// payloads captured from a cluster.
+type fixtureFetcher struct {
+	dir     string
+	metrics *targetMetrics
+}
+
+// fixturePath returns the file the response for endpoint is read from.
+func (f fixtureFetcher) fixturePath(endpoint string) string {
+	name := strings.Replace(strings.Trim(endpoint, "/"), "/", "_", -1)
+	return filepath.Join(f.dir, name+".json")
+}
+
+func (f fixtureFetcher) fetchAndDecode(endpoint string, target interface{}) bool {
+	ok := f.decode(endpoint, target)
+	f.metrics.fetched(endpoint, ok)
+	return ok
+}
+
+func (f fixtureFetcher) decode(endpoint string, target interface{}) bool {
+	path := f.fixturePath(endpoint)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && optionalEndpoints[endpoint] {
+		log.WithField("file", path).Debug("optional fixture not found")
+		return true
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  path,
+			"error": err,
+		}).Error("Error reading fixture")
+		errorCounter.WithLabelValues(endpoint, "fetch").Inc()
+		return false
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(target); err != nil {
+		log.WithFields(log.Fields{
+			"file":  path,
+			"error": err,
+		}).Error("Error decoding fixture")
+		errorCounter.WithLabelValues(endpoint, "decode").Inc()
+		return false
+	}
+	return true
+}
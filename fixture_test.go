@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixtureFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range map[string]string{
+		"version.json":          `{"version": "1.7.2"}`,
+		"metrics_snapshot.json": `{"master/elected": 1}`,
+		"state.json":            `{"version": "1.7.2"`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := fixtureFetcher{dir: dir}
+
+	var vf versionFields
+	if !f.fetchAndDecode("/version", &vf) || vf.Version != "1.7.2" {
+		t.Errorf("got version %q, want 1.7.2", vf.Version)
+	}
+	var m metricMap
+	if !f.fetchAndDecode("/metrics/snapshot", &m) || m["master/elected"] != 1 {
+		t.Errorf("got snapshot %v, want master/elected 1", m)
+	}
+	var s state
+	if f.fetchAndDecode("/state", &s) {
+		t.Error("got success decoding a truncated state.json")
+	}
+	if f.fetchAndDecode("/flags", &masterFlags{}) {
+		t.Error("got success without flags.json")
+	}
+
+	os.Remove(filepath.Join(dir, "version.json"))
+	if !f.fetchAndDecode("/version", &versionFields{}) {
+		t.Error("got failure without the optional version.json")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// numericMasterFlags are the master flags exported as values, with the
+// parsers of their values. Durations are exported in seconds.
+var numericMasterFlags = map[string]func(string) (float64, error){
+	"agent_ping_timeout":                  parseMesosDuration,
+	"agent_reregister_timeout":            parseMesosDuration,
+	"allocation_interval":                 parseMesosDuration,
+	"max_agent_ping_timeouts":             parseNumber,
+	"max_completed_frameworks":            parseNumber,
+	"max_completed_tasks_per_framework":   parseNumber,
+	"max_unreachable_tasks_per_framework": parseNumber,
+	"offer_timeout":                       parseMesosDuration,
+	"quorum":                              parseNumber,
+	"registry_fetch_timeout":              parseMesosDuration,
+	"registry_max_agent_age":              parseMesosDuration,
+	"registry_max_agent_count":            parseNumber,
+	"registry_store_timeout":              parseMesosDuration,
+}
+
+// numericSlaveFlags are the slave flags exported as values, like
+// numericMasterFlags.
+var numericSlaveFlags = map[string]func(string) (float64, error){
+	"container_disk_watch_interval":         parseMesosDuration,
+	"disk_watch_interval":                   parseMesosDuration,
+	"executor_registration_timeout":         parseMesosDuration,
+	"executor_shutdown_grace_period":        parseMesosDuration,
+	"gc_delay":                              parseMesosDuration,
+	"max_completed_executors_per_framework": parseNumber,
+	"oversubscribed_resources_interval":     parseMesosDuration,
+	"qos_update_interval":                   parseMesosDuration,
+	"recovery_timeout":                      parseMesosDuration,
+	"registration_backoff_factor":           parseMesosDuration,
+}
+
+func parseNumber(value string) (float64, error) {
+	return strconv.ParseFloat(value, 64)
+}
+
+var (
+	mesosDurationRE    = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(ns|us|ms|secs|mins|hrs|days|weeks)$`)
+	mesosDurationUnits = map[string]float64{
+		"ns":    1e-9,
+		"us":    1e-6,
+		"ms":    1e-3,
+		"secs":  1,
+		"mins":  60,
+		"hrs":   60 * 60,
+		"days":  24 * 60 * 60,
+		"weeks": 7 * 24 * 60 * 60,
+	}
+)
+
+// parseMesosDuration parses a duration as printed by Mesos, such as 15secs,
+// into seconds.
+func parseMesosDuration(value string) (float64, error) {
+	m := mesosDurationRE.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mesosDurationUnits[m[2]], nil
+}
+
+// masterFlags is the response of the /flags endpoint of masters and slaves.
+type masterFlags struct {
+	Flags map[string]string `json:"flags"`
+}
+
+// flagsCollector exports the configuration of a master or slave from /flags.
+// Only the flags asked for become labels, which bounds the cardinality.
+type flagsCollector struct {
+	fetcher
+	flags   []string
+	numeric map[string]func(string) (float64, error)
+	info    *prometheus.GaugeVec
+	value   *prometheus.GaugeVec
+}
+
+func newMasterFlagsCollector(fetcher fetcher, exportedFlags []string) prometheus.Collector {
+	return newFlagsCollector(fetcher, "master", exportedFlags, numericMasterFlags)
+}
+
+func newSlaveFlagsCollector(fetcher fetcher, exportedFlags []string) prometheus.Collector {
+	return newFlagsCollector(fetcher, "slave", exportedFlags, numericSlaveFlags)
+}
+
+func newFlagsCollector(fetcher fetcher, subsystem string, exportedFlags []string, numeric map[string]func(string) (float64, error)) *flagsCollector {
+	return &flagsCollector{
+		fetcher: fetcher,
+		flags:   exportedFlags,
+		numeric: numeric,
+		info:    gauge(subsystem, "flags_info", fmt.Sprintf("Flags the %s runs with, stored in labeling", subsystem), normaliseLabelList(exportedFlags)...),
+		value:   gauge(subsystem, "flag_value", fmt.Sprintf("Value of numeric %s flags, durations in seconds", subsystem), "flag"),
+	}
+}
+
+func (c *flagsCollector) Collect(ch chan<- prometheus.Metric) {
+	var f masterFlags
+	if !c.fetchAndDecode("/flags", &f) {
+		return
+	}
+	values := []string{}
+	for _, flag := range c.flags {
+		values = append(values, f.Flags[flag])
+	}
+	c.info.Reset()
+	c.info.WithLabelValues(values...).Set(1)
+	c.info.Collect(ch)
+
+	c.value.Reset()
+	for flag, parse := range c.numeric {
+		value, ok := f.Flags[flag]
+		if !ok {
+			continue
+		}
+		if n, err := parse(value); err == nil {
+			c.value.WithLabelValues(flag).Set(n)
+		}
+	}
+	c.value.Collect(ch)
+}
+
+func (c *flagsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.info.Describe(ch)
+	c.value.Describe(ch)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMasterFlagsCollector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"flags": {"max_agent_ping_timeouts": "5", "roles": "web,batch", "agent_ping_timeout": "15secs", "offer_timeout": "", "work_dir": "/var/lib/mesos"}}`))
+	}))
+	defer srv.Close()
+	c := newMasterFlagsCollector(&httpClient{Client: *srv.Client(), url: srv.URL}, []string{"max_agent_ping_timeouts", "roles", "quiet"})
+
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+	if len(ch) != 3 {
+		t.Fatalf("got %d metrics, want 3", len(ch))
+	}
+	var m dto.Metric
+	(<-ch).Write(&m)
+	for name, want := range map[string]string{"max_agent_ping_timeouts": "5", "roles": "web,batch", "quiet": ""} {
+		if got := labelValue(&m, name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if labelValue(&m, "work_dir") != "" {
+		t.Error("got a label for a flag which was not asked for")
+	}
+}
+
+func TestMasterFlagsCollector_Values(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"flags": {"max_agent_ping_timeouts": "5", "agent_ping_timeout": "15secs", "offer_timeout": "", "registry_max_agent_age": "2weeks"}}`))
+	}))
+	defer srv.Close()
+	c := newMasterFlagsCollector(&httpClient{Client: *srv.Client(), url: srv.URL}, nil).(*flagsCollector)
+	c.Collect(make(chan prometheus.Metric, 10))
+
+	got := map[string]float64{}
+	for _, m := range collectMetrics(c.value) {
+		got[labelValue(m, "flag")] = m.GetGauge().GetValue()
+	}
+	want := map[string]float64{"max_agent_ping_timeouts": 5, "agent_ping_timeout": 15, "registry_max_agent_age": 1209600}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestSlaveFlagsCollector(t *testing.T) {
+	c := newSlaveFlagsCollector(fakeFetcher{
+		"/flags": `{"flags": {"work_dir": "/var/lib/mesos", "containerizers": "mesos,docker", "gc_delay": "1weeks", "agent_ping_timeout": "15secs"}}`,
+	}, []string{"work_dir", "containerizers"}).(*flagsCollector)
+
+	c.Collect(make(chan prometheus.Metric, 10))
+	ms := collectMetrics(c.info)
+	if len(ms) != 1 {
+		t.Fatalf("got %d mesos_slave_flags_info metrics, want 1", len(ms))
+	}
+	for name, want := range map[string]string{"work_dir": "/var/lib/mesos", "containerizers": "mesos,docker"} {
+		if got := labelValue(ms[0], name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+
+	got := map[string]float64{}
+	for _, m := range collectMetrics(c.value) {
+		got[labelValue(m, "flag")] = m.GetGauge().GetValue()
+	}
+	// agent_ping_timeout is a master flag.
+	want := map[string]float64{"gc_delay": 604800}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestParseMesosDuration(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  float64
+		valid bool
+	}{
+		{"15secs", 15, true},
+		{"1.5mins", 90, true},
+		{"100ms", 0.1, true},
+		{"2hrs", 7200, true},
+		{"15", 0, false},
+		{"secs", 0, false},
+		{"", 0, false},
+	} {
+		got, err := parseMesosDuration(tt.value)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("%q: got %v, %v, want %v, valid: %v", tt.value, got, err, tt.want, tt.valid)
+		}
+	}
+}
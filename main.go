@@ -2,36 +2,97 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
 	log "github.com/sirupsen/logrus"
 )
 
-var errorCounter = prometheus.NewCounter(prometheus.CounterOpts{
-	Namespace: "mesos",
-	Subsystem: "collector",
-	Name:      "errors_total",
-	Help:      "Total number of internal mesos-collector errors.",
-})
+var (
+	errorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mesos",
+		Subsystem: "collector",
+		Name:      "errors_total",
+		Help:      "Total number of internal mesos-collector errors by endpoint and kind of error.",
+	}, []string{"endpoint", "kind"})
+
+	droppedAttributes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mesos_exporter",
+		Name:      "dropped_attributes_total",
+		Help:      "Total number of times a slave attribute was left out of the labels asked for, by reason: not_text or unparseable.",
+	}, []string{"reason"})
+
+	collectorEnabled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mesos_exporter",
+		Name:      "collector_enabled",
+		Help:      "1 if the collector is enabled, 0 if it is disabled.",
+	}, []string{"collector"})
+
+	configHash = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mesos_exporter",
+		Name:      "config_hash",
+		Help:      "Hash of the flags the exporter was started with, which differs between instances configured differently.",
+	})
+
+	// inflightRequests counts the requests to Mesos being sent or read.
+	inflightRequests      int64
+	inflightRequestsGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "mesos_exporter",
+		Name:      "inflight_requests",
+		Help:      "Number of requests to Mesos whose response has not been read yet.",
+	}, func() float64 {
+		return float64(atomic.LoadInt64(&inflightRequests))
+	})
+
+	// registry holds the metrics of the exporter itself, its Go runtime and
+	// process included, next to those of the collectors served on /metrics.
+	registry = prometheus.NewRegistry()
+)
 
 func init() {
 	// Only log the warning severity or above.
 	log.SetLevel(log.ErrorLevel)
 
-	prometheus.MustRegister(errorCounter)
+	registry.MustRegister(prometheus.NewGoCollector())
+	registry.MustRegister(prometheus.NewProcessCollector(os.Getpid(), ""))
+	registry.MustRegister(errorCounter)
+	registry.MustRegister(droppedAttributes)
+	registry.MustRegister(collectorEnabled)
+	registry.MustRegister(inflightRequestsGauge)
+	registry.MustRegister(configHash)
+}
+
+// checkStrictMode validates the private key and login URL of a strict mode
+// client, which would otherwise only fail on the first scrape.
+func checkStrictMode(client *httpClient) error {
+	if _, err := jwt.ParseRSAPrivateKeyFromPEM(client.auth.signingKey); err != nil {
+		return fmt.Errorf("invalid private key: %s", err)
+	}
+	u, err := url.Parse(client.auth.loginURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid login URL %q", client.auth.loginURL)
+	}
+	return nil
 }
 
 func getX509CertPool(pemFiles []string) *x509.CertPool {
@@ -61,34 +122,127 @@ func getX509ClientCertificates(certFile, keyFile string) []tls.Certificate {
 	return []tls.Certificate{cert}
 }
 
-func mkHTTPClient(url string, timeout time.Duration, auth authInfo, certPool *x509.CertPool, certs []tls.Certificate) *httpClient {
+// idleConnTimeout is how long connections to Mesos are kept open unused,
+// that of http.DefaultTransport.
+const idleConnTimeout = 90 * time.Second
+
+// httpOptions are the HTTP client settings shared by all targets.
+type httpOptions struct {
+	timeout          time.Duration
+	loginTimeout     time.Duration
+	maxResponseBytes int64
+	failOnRedirect   bool
+	apiVersion       string
+	breakerFailures  int
+	breakerCooldown  time.Duration
+	headers          http.Header
+	hostHeader       string
+	sendRequestID    bool
+	acceptZstd       bool
+
+	salvageTruncatedState bool
+	slaveAuth             bool
+	disableSessionTickets bool
+	renegotiation         tls.RenegotiationSupport
+	disableHTTP2          bool
+
+	// fanout and debugState are shared by all clients
+	fanout     semaphore
+	debugState *stateCache
+	// metrics are shared by the clients of a target
+	metrics *targetMetrics
+	// scrape is shared by the clients of the collectors served together
+	scrape *scrapeScope
+}
+
+// withMetrics returns opts for the clients of the target reported by m.
+func (opts httpOptions) withMetrics(m *targetMetrics) httpOptions {
+	opts.metrics = m
+	return opts
+}
+
+func mkHTTPClient(url string, opts httpOptions, auth authInfo, certPool *x509.CertPool, certs []tls.Certificate) *httpClient {
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			Certificates:       certs,
 			RootCAs:            certPool,
 			InsecureSkipVerify: auth.skipSSLVerify,
+			// Go's defaults enable session tickets and refuse renegotiation.
+			SessionTicketsDisabled: opts.disableSessionTickets,
+			Renegotiation:          opts.renegotiation,
 		},
+		// A custom TLS config disables HTTP/2 unless it's forced.
+		ForceAttemptHTTP2: !opts.disableHTTP2,
+		// Connections are otherwise kept open as long as the client is,
+		// which /probe drops for the targets probed least recently.
+		IdleConnTimeout: idleConnTimeout,
+	}
+	if opts.disableHTTP2 {
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	// unix:///path/to/socket talks HTTP over the given Unix domain socket.
+	if strings.HasPrefix(url, "unix://") {
+		socket := strings.TrimPrefix(url, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		url = "http://localhost"
 	}
 
 	// HTTP Redirects are authenticated by Go (>=1.8), when redirecting to an identical domain or a subdomain.
 	// -> Hijack redirect authentication, since hostnames rarely follow this logic.
 	var redirectFunc func(req *http.Request, via []*http.Request) error
-	if auth.username != "" && auth.password != "" {
+	if auth.username != "" && auth.password != "" && !auth.digest {
 		// Auth information is only available in the current context -> use lambda function
 		redirectFunc = func(req *http.Request, via []*http.Request) error {
-			req.SetBasicAuth(auth.username, auth.password)
+			// Agents are only sent credentials if configured to.
+			if via[0].Header.Get("Authorization") != "" {
+				req.SetBasicAuth(auth.username, auth.password)
+			}
+			return nil
+		}
+	}
+	if opts.failOnRedirect {
+		follow := redirectFunc
+		redirectFunc = func(req *http.Request, via []*http.Request) error {
+			if !isLeaderRedirect(req, via) {
+				return &redirectError{location: req.URL.String()}
+			}
+			log.WithField("location", req.URL.String()).Debug("following redirect to the leading master")
+			if follow != nil {
+				return follow(req, via)
+			}
 			return nil
 		}
 	}
 
 	client := &httpClient{
-		http.Client{Timeout: timeout, Transport: transport, CheckRedirect: redirectFunc},
-		url,
-		auth,
-		"",
+		Client:           http.Client{Timeout: opts.timeout, Transport: transport, CheckRedirect: redirectFunc},
+		url:              url,
+		auth:             auth,
+		maxResponseBytes: opts.maxResponseBytes,
+		apiVersion:       opts.apiVersion,
+		loginTimeout:     opts.loginTimeout,
+		headers:          opts.headers,
+		hostHeader:       opts.hostHeader,
+		sendRequestID:    opts.sendRequestID,
+		acceptZstd:       opts.acceptZstd,
+		fanout:           opts.fanout,
+		debugState:       opts.debugState,
+		metrics:          opts.metrics,
+		scrape:           opts.scrape,
+
+		salvageTruncatedState: opts.salvageTruncatedState,
+		slaveAuth:             opts.slaveAuth,
+	}
+	if opts.breakerFailures > 0 {
+		client.breakers = newCircuitBreakers(opts.breakerFailures, opts.breakerCooldown)
 	}
 
 	if auth.strictMode {
+		opts.metrics.enableAuth()
 		client.auth.signingKey = parsePrivateKey(client)
 	}
 
@@ -101,6 +255,25 @@ func mkHTTPClient(url string, timeout time.Duration, auth authInfo, certPool *x5
 	return client
 }
 
+// mkAgentHTTPClient returns a client for the agent at url. The v1 calls
+// replacing /state and the other v0 endpoints are those of the master, so
+// agents are always fetched from the v0 API.
+func mkAgentHTTPClient(url string, opts httpOptions, auth authInfo, certPool *x509.CertPool, certs []tls.Certificate) *httpClient {
+	opts.apiVersion = "v0"
+	return mkHTTPClient(url, opts, auth, certPool, certs)
+}
+
+// isLeaderRedirect tells the redirect of a master which isn't leading to
+// the leader, a 307 to the same path on another host, apart from those
+// -failOnRedirect refuses.
+func isLeaderRedirect(req *http.Request, via []*http.Request) bool {
+	if len(via) != 1 || req.Response == nil || req.Response.StatusCode != http.StatusTemporaryRedirect {
+		return false
+	}
+	prev := via[0].URL
+	return req.URL.Host != prev.Host && req.URL.Path == prev.Path && req.URL.RawQuery == prev.RawQuery
+}
+
 func parsePrivateKey(httpClient *httpClient) []byte {
 	if _, err := os.Stat(httpClient.auth.privateKey); os.IsNotExist(err) {
 		buffer := bytes.NewBuffer([]byte(httpClient.auth.privateKey))
@@ -110,7 +283,7 @@ func parsePrivateKey(httpClient *httpClient) []byte {
 				"key":   key,
 				"error": err,
 			}).Error("Error decoding prviate key")
-			errorCounter.Inc()
+			errorCounter.WithLabelValues("", "private_key").Inc()
 			return []byte{}
 		}
 		httpClient.auth.username = key.UID
@@ -124,7 +297,7 @@ func parsePrivateKey(httpClient *httpClient) []byte {
 			"absPath": absPath,
 			"error":   err,
 		}).Error("Error reading prviate key")
-		errorCounter.Inc()
+		errorCounter.WithLabelValues("", "private_key").Inc()
 		return []byte{}
 	}
 	return key
@@ -140,26 +313,291 @@ func csvInputToList(input string) []string {
 	return entryList
 }
 
+var tlsRenegotiationModes = map[string]tls.RenegotiationSupport{
+	"never":  tls.RenegotiateNever,
+	"once":   tls.RenegotiateOnceAsClient,
+	"freely": tls.RenegotiateFreelyAsClient,
+}
+
+// headerFlag collects the repeatable -header flag. A value starting with @
+// is read from the named file, which keeps secrets off the command line.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return ""
+}
+
+func (h headerFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("header must look like 'Name: value': %s", value)
+	}
+	name, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if strings.HasPrefix(v, "@") {
+		content, err := ioutil.ReadFile(v[1:])
+		if err != nil {
+			return err
+		}
+		v = strings.TrimSpace(string(content))
+	}
+	http.Header(h).Add(name, v)
+	return nil
+}
+
+// unhashedFlags are left out of hashFlags. The addresses of the exporter and
+// of the masters or agents it fetches, and the log level, differ between
+// exporters configured alike. The credentials, and the paths of the files
+// holding them, are left out as the hash would help guessing them.
+var unhashedFlags = map[string]bool{
+	"addr":                true,
+	"master":              true,
+	"slave":               true,
+	"masters":             true,
+	"srvRecord":           true,
+	"zk":                  true,
+	"fixtureDir":          true,
+	"probeAllowedTargets": true,
+	"loginURL":            true,
+	"logLevel":            true,
+	"version":             true,
+
+	"username":     true,
+	"password":     true,
+	"header":       true,
+	"privateKey":   true,
+	"tokenFile":    true,
+	"clientCert":   true,
+	"clientKey":    true,
+	"trustedCerts": true,
+}
+
+// hashFlags returns the 32-bit FNV-1a hash, which a float64 holds exactly, of
+// the values of the flags but unhashedFlags. Flags are visited in
+// lexicographical order, so the hash is stable across restarts with the same
+// flags.
+func hashFlags(fs *flag.FlagSet) uint32 {
+	h := fnv.New32a()
+	fs.VisitAll(func(f *flag.Flag) {
+		if !unhashedFlags[f.Name] {
+			fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value)
+		}
+	})
+	return h.Sum32()
+}
+
+// validHost tells if host is a host name or address, optionally with a port,
+// as sent in the Host header.
+func validHost(host string) bool {
+	u, err := url.Parse("//" + host)
+	return err == nil && u.Host == host && u.Hostname() != ""
+}
+
+// masterOptions selects the collectors registered for a master.
+type masterOptions struct {
+	collector         collectorOptions
+	enableMasterState bool
+	state             masterStateOptions
+	enableFlags       bool
+	exportedFlags     []string
+	enableQuota       bool
+	// enableSlaveVersions fetches the version of every agent
+	enableSlaveVersions bool
+	// stateRefreshInterval, if set, fetches /state in the background at
+	// this interval instead of on every scrape
+	stateRefreshInterval time.Duration
+}
+
+// setCollectorsEnabled reports which collectors are enabled, by the name of
+// their timedCollector.
+func setCollectorsEnabled(enabled map[string]bool) {
+	for name, ok := range enabled {
+		if ok {
+			collectorEnabled.WithLabelValues(name).Set(1)
+		} else {
+			collectorEnabled.WithLabelValues(name).Set(0)
+		}
+	}
+}
+
+// registerMasterCollectors registers the collectors of a master with
+// registerer, along with the metrics of its fetches, which newFetcher passes
+// to the fetchers it returns. The background fetches of
+// stateRefreshInterval run until ctx is done.
+func registerMasterCollectors(ctx context.Context, registerer prometheus.Registerer, newFetcher func(*targetMetrics) fetcher, opts masterOptions) error {
+	setCollectorsEnabled(map[string]bool{
+		"master":        true,
+		"master_state":  opts.enableMasterState,
+		"master_flags":  opts.enableFlags,
+		"quota":         opts.enableQuota,
+		"slave_version": opts.enableSlaveVersions,
+	})
+
+	metrics, err := newTargetMetrics(registerer, true)
+	if err != nil {
+		return err
+	}
+	newClient := func() fetcher {
+		return newFetcher(metrics)
+	}
+
+	collectors := []prometheus.Collector{newTimedCollector("master", newMasterCollector(newClient(), opts.collector))}
+	var refresher *stateRefresher
+	if opts.enableMasterState {
+		client := newClient()
+		if opts.stateRefreshInterval > 0 {
+			// Background fetches aren't part of any scrape.
+			if c, ok := client.(*httpClient); ok {
+				c.scrape = nil
+			}
+			refresher = newStateRefresher(client)
+			collectors = append(collectors, refresher)
+			client = refresher
+		}
+		collectors = append(collectors, newTimedCollector("master_state", newMasterStateCollector(client, opts.state, opts.collector)))
+	}
+	if opts.enableFlags {
+		collectors = append(collectors, newTimedCollector("master_flags", newMasterFlagsCollector(newClient(), opts.exportedFlags)))
+	}
+	if opts.enableQuota {
+		collectors = append(collectors, newTimedCollector("quota", newQuotaCollector(newClient(), opts.collector)))
+	}
+	if opts.enableSlaveVersions {
+		// The agents are fetched from the URLs the master reports, which
+		// takes an HTTP client.
+		client, ok := newClient().(*httpClient)
+		if !ok {
+			return errors.New("-enableSlaveVersions requires fetching from the master over HTTP")
+		}
+		collectors = append(collectors, newTimedCollector("slave_version", newSlaveVersionCollector(client)))
+	}
+
+	for _, c := range collectors {
+		if err := registerer.Register(c); err != nil {
+			return err
+		}
+	}
+	if refresher != nil {
+		go refresher.run(ctx, opts.stateRefreshInterval)
+	}
+	return nil
+}
+
+// warmUp collects the metrics once, so that the first scrape doesn't find
+// collectors which have not fetched from Mesos yet. It returns the endpoints
+// whose fetch failed.
+func warmUp(g prometheus.Gatherer) []string {
+	mfs, err := g.Gather()
+	if err != nil {
+		log.WithField("error", err).Warn("Error gathering metrics on warm-up")
+	}
+	// The endpoints failed by several targets are only returned once.
+	seen := map[string]bool{}
+	var failed []string
+	for _, mf := range mfs {
+		if mf.GetName() != scrapeErrorsLastName {
+			continue
+		}
+		for _, m := range mf.Metric {
+			var endpoint string
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "endpoint" {
+					endpoint = l.GetValue()
+				}
+			}
+			if m.GetGauge().GetValue() == 1 && !seen[endpoint] {
+				seen[endpoint] = true
+				failed = append(failed, endpoint)
+			}
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
 func main() {
 	fs := flag.NewFlagSet("mesos-exporter", flag.ExitOnError)
 	addr := fs.String("addr", ":9105", "Address to listen on")
-	masterURL := fs.String("master", "", "Expose metrics from master running on this URL")
-	slaveURL := fs.String("slave", "", "Expose metrics from slave running on this URL")
+	masterURL := fs.String("master", "", "Expose metrics from master running on this URL, or listening on the Unix socket of a unix:///path URL")
+	slaveURL := fs.String("slave", "", "Expose metrics from slave running on this URL, or listening on the Unix socket of a unix:///path URL")
+	srvRecord := fs.String("srvRecord", "", "Expose metrics from the masters listed in this DNS SRV record, in priority order")
+	srvScheme := fs.String("srvScheme", "http", "URL scheme used for the masters listed in -srvRecord")
+	srvRefresh := fs.Duration("srvRefresh", 30*time.Second, "Interval at which -srvRecord is resolved again")
+	zkURL := fs.String("zk", "", "Expose metrics from the leading master registered in ZooKeeper at this zk:// URL (requires a build with -tags zk)")
+	zkScheme := fs.String("zkScheme", "http", "URL scheme used for the master discovered via -zk")
+	mastersFile := fs.String("masters", "", "Path to a JSON file listing several masters to expose metrics from, each with its own cluster label, authentication and TLS settings")
 	timeout := fs.Duration("timeout", 10*time.Second, "Master polling timeout")
+	failOnRedirect := fs.Bool("failOnRedirect", false, "Treat redirects returned by Mesos as scrape failures instead of following them, except for a master redirecting to the leader")
+	breakerFailures := fs.Int("circuitBreakerFailures", 0, "Number of consecutive failures after which fetching an endpoint is suspended, 0 to never suspend")
+	breakerCooldown := fs.Duration("circuitBreakerCooldown", time.Minute, "Time fetching an endpoint is suspended for by -circuitBreakerFailures")
+	headers := headerFlag{}
+	fs.Var(headers, "header", "Extra HTTP header sent with every request to Mesos, as 'Name: value' or 'Name: @file' to read the value from a file (repeatable)")
+	hostHeader := fs.String("hostHeader", "", "Host header sent to the master and the login URL instead of the host of their URL, for masters behind a virtual-hosting load balancer")
+	salvageTruncatedState := fs.Bool("salvageTruncatedState", false, "Export the metrics of the fields of a /state response cut short that were received in full, instead of failing the scrape. The fetch is still reported as failed")
+	acceptZstd := fs.Bool("acceptZstd", false, "Accept zstd as well as gzip compressed responses from Mesos endpoints")
+	sendRequestID := fs.Bool("sendRequestID", false, "Send the id of the scrape, which is logged at debug level, as X-Request-ID header to Mesos")
+	scrapeConcurrency := fs.Int("scrapeConcurrency", 10, "Maximum number of requests to agents run in parallel by collectors fanning out to every agent")
+	apiVersion := fs.String("apiVersion", "v0", "Mesos API version to use for masters where both exist, v0 or v1 (the v1 operator API on /api/v1)")
+	maxResponseBytes := fs.Int64("maxResponseBytes", 512*1024*1024, "Maximum size of a response body read from Mesos, 0 for no limit")
 	exportedTaskLabels := fs.String("exportedTaskLabels", "", "Comma-separated list of task labels to include in the corresponding metric")
 	exportedSlaveAttributes := fs.String("exportedSlaveAttributes", "", "Comma-separated list of slave attributes to include in the corresponding metric")
 	trustedCerts := fs.String("trustedCerts", "", "Comma-separated list of certificates (.pem files) trusted for requests to Mesos endpoints")
 	clientCertFile := fs.String("clientCert", "", "Path to Mesos client TLS certificate (.pem file)")
 	clientKeyFile := fs.String("clientKey", "", "Path to Mesos client TLS key file (.pem file)")
+	disableHTTP2 := fs.Bool("disableHTTP2", false, "Only use HTTP/1.1 for requests to Mesos endpoints, instead of negotiating HTTP/2 over TLS")
+	tlsDisableSessionTickets := fs.Bool("tlsDisableSessionTickets", false, "Disable TLS session resumption with session tickets for requests to Mesos endpoints")
+	enableParentRoleLabel := fs.Bool("parentRoleLabel", false, "Add a parent_role label, the role a hierarchical role such as eng/team-a is nested in, to the metrics by role")
+	snapshotRetryEmpty := fs.Bool("snapshotRetryEmpty", false, "Fetch /metrics/snapshot once more if it is empty, as right after a master starts")
+	snapshotKeepLast := fs.Bool("snapshotKeepLast", false, "Export the metrics of the last non-empty /metrics/snapshot in place of an empty one")
+	memoryUnitName := fs.String("memoryUnit", "bytes", "Unit of the memory and disk sizes of slaves, frameworks and quotas, which is also the suffix of their metric names: bytes or mib (mebibytes, as Mesos reports them)")
+	versionBuildTime := fs.String("versionBuildTime", "float", "Format of the build_time label of mesos_version: float (Unix time) or rfc3339")
+	tlsRenegotiation := fs.String("tlsRenegotiation", "never", "TLS renegotiation accepted from Mesos endpoints: never, once or freely")
 	strictMode := fs.Bool("strictMode", false, "Use strict mode authentication")
+	tokenFilePath := fs.String("tokenFile", "", "Path to a file holding a pre-issued authentication token, used instead of the strict mode login")
+	tokenFileRefresh := fs.Duration("tokenFileRefresh", time.Minute, "Interval at which -tokenFile is read again, it is also read on SIGHUP")
 	username := fs.String("username", "", "Username for authentication")
 	password := fs.String("password", "", "Password for authentication")
+	authScheme := fs.String("authScheme", "basic", "HTTP authentication scheme used with -username and -password: basic or digest")
+	loginTimeout := fs.Duration("loginTimeout", 0, "Strict mode login timeout, 0 to only apply -timeout")
 	loginURL := fs.String("loginURL", "https://leader.mesos/acs/api/v1/auth/login", "URL for strict mode authentication")
 	logLevel := fs.String("logLevel", "error", "Log level")
 	privateKey := fs.String("privateKey", "", "File path to certificate for strict mode authentication")
 	skipSSLVerify := fs.Bool("skipSSLVerify", false, "Skip SSL certificate verification")
 	vers := fs.Bool("version", false, "Show version")
 	enableMasterState := fs.Bool("enableMasterState", true, "Enable collection from the master's /state endpoint")
+	stateRefreshInterval := fs.Duration("stateRefreshInterval", 0, "Fetch the master's /state in the background at this interval, exporting the last state fetched on scrapes, 0 to fetch it on every scrape")
+	enableMasterFlags := fs.Bool("enableMasterFlags", false, "Enable collection from the master's /flags endpoint")
+	exportedMasterFlags := fs.String("exportedMasterFlags", "", "Comma-separated list of master flags to include as labels of mesos_master_flags_info")
+	enableSlaveFlags := fs.Bool("enableSlaveFlags", false, "Enable collection from the slave's /flags endpoint")
+	exportedSlaveFlags := fs.String("exportedSlaveFlags", "", "Comma-separated list of slave flags to include as labels of mesos_slave_flags_info")
+	enableSlaveContainers := fs.Bool("enableSlaveContainers", false, "Enable collection of the number of containers from the slave's /containers endpoint")
+	enableFrameworkInfo := fs.Bool("enableFrameworkInfo", false, "Export the id, name and web UI URL as well as the used and offered resources, retained completed tasks and reregistration time of frameworks from the master's /state endpoint")
+	enableSlaveVersions := fs.Bool("enableSlaveVersions", false, "Fetch the /version endpoint of every slave registered with the master, at most -scrapeConcurrency at a time")
+	slaveVersionAuth := fs.Bool("slaveVersionAuth", false, "Send the credentials used for the master to the slaves fetched by -enableSlaveVersions as well")
+	enableQuota := fs.Bool("enableQuota", false, "Enable collection of role quotas from the master's /quota endpoint")
+	roundResources := fs.Int("roundResources", -1, "Number of decimals to round slave resource values to, negative to export them unrounded")
+	slaveLabelIP := fs.Bool("slaveLabelIP", false, "Add the IP address of slaves, taken from their PID, as an ip label to the slave metrics from the master")
+	nodeExporterPort := fs.Int("nodeExporterPort", 0, "Port of the node_exporter on the slaves. If set, the slave metrics from the master get a node_instance label of the slave hostname and this port")
+	enableSlaveAllocations := fs.Bool("enableSlaveAllocations", false, "Export the CPUs, memory and disk allocated on every slave by role from the master's /state endpoint, which add up to the *_allocated slave metrics")
+	enableTaskResources := fs.Bool("enableTaskResources", false, "Export the resources of every task, and of its executor, from the master's /state endpoint")
+	enableTaskHealth := fs.Bool("enableTaskHealth", false, "Export whether the tasks with a health check are healthy from the master's /state endpoint")
+	enableClusterReservations := fs.Bool("enableClusterReservations", false, "Export the resources reserved on all slaves by role from the master's /state endpoint")
+	enableSlavePortRanges := fs.Bool("enableSlavePortRanges", false, "Export the lowest and highest port of every slave from the master's /state endpoint")
+	enableSlaveResources := fs.Bool("enableSlaveResources", false, "Export every scalar resource of every slave, custom resources included, from the master's /state endpoint")
+	enableSlaveReservations := fs.Bool("enableSlaveReservations", false, "Export the resources reserved on every slave by role from the master's /state endpoint")
+	maxFrameworks := fs.Int("maxFrameworks", 0, "Maximum number of frameworks from the master's /state endpoint the metrics are derived from, which bounds the number of series but not the memory used to decode /state, 0 for no limit")
+	maxTasks := fs.Int("maxTasks", 0, "Maximum number of tasks from the master's /state endpoint the metrics are derived from, which bounds the number of series but not the memory used to decode /state, 0 for no limit")
+	onlyActiveFrameworks := fs.Bool("onlyActiveFrameworks", false, "Leave inactive frameworks and their tasks out of the framework and task metrics from the master's /state endpoint")
+	onlyActiveSlaves := fs.Bool("onlyActiveSlaves", false, "Leave inactive slaves out of the slave metrics from the master's /state endpoint")
+	fixtureDir := fs.String("fixtureDir", "", "Expose master metrics read from the state.json, metrics_snapshot.json and version.json files in this directory instead of fetching them from a master")
+	enableProbe := fs.Bool("enableProbe", false, "Expose metrics of the master given by the target parameter on /probe")
+	probeAllowedTargets := fs.String("probeAllowedTargets", "", "Comma-separated list of the only master URLs probed on /probe, which are sent the credentials of the exporter; unlisted targets are probed without credentials if empty")
+	probeMaxTargets := fs.Int("probeMaxTargets", 100, "Maximum number of /probe targets whose collectors are kept, 0 for no limit")
+	enableDebugState := fs.Bool("enableDebugState", false, "Serve the last v0 /state response fetched from every master on /debug/state, except those of /probe")
+	debugStateMaxBytes := fs.Int("debugStateMaxBytes", 8*1024*1024, "Maximum number of bytes of the /state response of each master kept for /debug/state")
+	metricsKeepRegex := fs.String("metricsKeepRegex", "", "Only expose the metrics on /metrics whose name matches this regular expression")
+	metricsDropRegex := fs.String("metricsDropRegex", "", "Don't expose the metrics on /metrics whose name matches this regular expression")
+	warmup := fs.Bool("warmup", false, "Collect the metrics once at startup, before serving /metrics")
+	warmupRequired := fs.Bool("warmupRequired", false, "Exit if fetching an endpoint fails during the -warmup collection")
 
 	fs.Parse(os.Args[1:])
 
@@ -167,9 +605,41 @@ func main() {
 		fmt.Println(version.Print("mesos_exporter"))
 		os.Exit(0)
 	}
+	configHash.Set(float64(hashFlags(fs)))
 
-	if *masterURL != "" && *slaveURL != "" {
-		log.Fatal("Only -master or -slave can be given at a time")
+	modes := 0
+	for _, mode := range []string{*masterURL, *slaveURL, *mastersFile, *srvRecord, *zkURL, *fixtureDir} {
+		if mode != "" {
+			modes++
+		}
+	}
+	if modes > 1 {
+		log.Fatal("Only one of -master, -slave, -masters, -srvRecord, -zk or -fixtureDir can be given at a time")
+	}
+
+	if *hostHeader != "" && !validHost(*hostHeader) {
+		log.WithField("hostHeader", *hostHeader).Fatal("-hostHeader must be a host name or address, optionally with a port")
+	}
+	if *apiVersion != "v0" && *apiVersion != "v1" {
+		log.WithField("apiVersion", *apiVersion).Fatal("-apiVersion must be v0 or v1")
+	}
+	if *debugStateMaxBytes < 0 {
+		log.WithField("debugStateMaxBytes", *debugStateMaxBytes).Fatal("-debugStateMaxBytes must not be negative")
+	}
+	collectorOpts := collectorOptions{
+		retryEmptySnapshot: *snapshotRetryEmpty,
+		keepLastSnapshot:   *snapshotKeepLast,
+		parentRoleLabel:    *enableParentRoleLabel,
+	}
+	if format, ok := buildTimeFormats[*versionBuildTime]; ok {
+		collectorOpts.formatBuildTime = format
+	} else {
+		log.WithField("versionBuildTime", *versionBuildTime).Fatal("-versionBuildTime must be float or rfc3339")
+	}
+	if unit, ok := memoryUnits[*memoryUnitName]; ok {
+		collectorOpts.memUnit = unit
+	} else {
+		log.WithField("memoryUnit", *memoryUnitName).Fatal("-memoryUnit must be bytes or mib")
 	}
 
 	// Getting logging setup with the appropriate log level
@@ -185,12 +655,29 @@ func main() {
 	log.Infoln("Starting mesos_exporter", version.Info())
 	log.Infoln("Build context", version.BuildContext())
 
-	prometheus.MustRegister(version.NewCollector("mesos_exporter"))
+	registry.MustRegister(version.NewCollector("mesos_exporter"))
 
+	if *authScheme != "basic" && *authScheme != "digest" {
+		log.WithField("authScheme", *authScheme).Fatal("-authScheme must be basic or digest")
+	}
 	auth := authInfo{
 		strictMode:    *strictMode,
 		skipSSLVerify: *skipSSLVerify,
 		loginURL:      *loginURL,
+		digest:        *authScheme == "digest",
+	}
+
+	if *tokenFilePath != "" {
+		if *strictMode {
+			log.Fatal("-tokenFile and -strictMode are mutually exclusive")
+		}
+		auth.tokenFile, err = newTokenFile(*tokenFilePath, *tokenFileRefresh)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"file":  *tokenFilePath,
+				"error": err,
+			}).Fatal("Error reading token file")
+		}
 	}
 
 	if *strictMode && *privateKey != "" {
@@ -229,49 +716,261 @@ func main() {
 		certs = getX509ClientCertificates(*clientCertFile, *clientKeyFile)
 	}
 
+	if *scrapeConcurrency < 1 {
+		log.WithField("scrapeConcurrency", *scrapeConcurrency).Fatal("-scrapeConcurrency must be at least 1")
+	}
+
+	renegotiation, ok := tlsRenegotiationModes[*tlsRenegotiation]
+	if !ok {
+		log.WithField("tlsRenegotiation", *tlsRenegotiation).Fatal("-tlsRenegotiation must be never, once or freely")
+	}
+
+	httpOpts := httpOptions{
+		timeout:          *timeout,
+		loginTimeout:     *loginTimeout,
+		maxResponseBytes: *maxResponseBytes,
+		failOnRedirect:   *failOnRedirect,
+		apiVersion:       *apiVersion,
+		breakerFailures:  *breakerFailures,
+		breakerCooldown:  *breakerCooldown,
+		headers:          http.Header(headers),
+		hostHeader:       *hostHeader,
+		sendRequestID:    *sendRequestID,
+		acceptZstd:       *acceptZstd,
+
+		salvageTruncatedState: *salvageTruncatedState,
+		slaveAuth:             *slaveVersionAuth,
+		disableSessionTickets: *tlsDisableSessionTickets,
+		disableHTTP2:          *disableHTTP2,
+		renegotiation:         renegotiation,
+		fanout:                newSemaphore(*scrapeConcurrency),
+		scrape:                &scrapeScope{},
+	}
+	if *enableDebugState {
+		if *apiVersion == "v1" {
+			log.Warn("-enableDebugState only keeps v0 /state responses, none are fetched with -apiVersion v1")
+		}
+		httpOpts.debugState = newStateCache(*debugStateMaxBytes)
+	}
+
+	if auth.strictMode {
+		if err := checkStrictMode(mkHTTPClient("", httpOpts, auth, certPool, certs)); err != nil {
+			log.WithField("error", err).Fatal("Invalid strict mode configuration")
+		}
+	}
+
 	slaveAttributeLabels := csvInputToList(*exportedSlaveAttributes)
 	slaveTaskLabels := csvInputToList(*exportedTaskLabels)
+	masterOpts := masterOptions{
+		collector:         collectorOpts,
+		enableMasterState: *enableMasterState,
+		state: masterStateOptions{
+			slaveAttributeLabels: slaveAttributeLabels,
+			slaveReservations:    *enableSlaveReservations,
+			clusterReservations:  *enableClusterReservations,
+			slaveResources:       *enableSlaveResources,
+			slavePortRanges:      *enableSlavePortRanges,
+			taskHealth:           *enableTaskHealth,
+			taskResources:        *enableTaskResources,
+			onlyActiveSlaves:     *onlyActiveSlaves,
+			onlyActiveFrameworks: *onlyActiveFrameworks,
+			slaveAllocations:     *enableSlaveAllocations,
+			roundResources:       *roundResources,
+			frameworkInfo:        *enableFrameworkInfo,
+			maxFrameworks:        *maxFrameworks,
+			maxTasks:             *maxTasks,
+			slaveIPLabel:         *slaveLabelIP,
+			nodeExporterPort:     *nodeExporterPort,
+		},
+		enableFlags:         *enableMasterFlags,
+		exportedFlags:       csvInputToList(*exportedMasterFlags),
+		enableQuota:         *enableQuota,
+		enableSlaveVersions: *enableSlaveVersions,
+
+		stateRefreshInterval: *stateRefreshInterval,
+	}
+
+	gatherers := prometheus.Gatherers{registry}
 
 	switch {
 	case *masterURL != "":
 		log.WithField("address", *addr).Info("Exposing master metrics")
 
-		if err := prometheus.Register(
-			newMasterCollector(mkHTTPClient(*masterURL, *timeout, auth, certPool, certs))); err != nil {
-			log.WithField("error", err).Fatal("Prometheus Register() error")
+		if err := registerMasterCollectors(context.Background(), registry, func(m *targetMetrics) fetcher {
+			return mkHTTPClient(*masterURL, httpOpts.withMetrics(m), auth, certPool, certs)
+		}, masterOpts); err != nil {
+			log.WithField("error", err).Fatal("Error registering master collectors")
 		}
 
-		if *enableMasterState {
-			if err := prometheus.Register(
-				newMasterStateCollector(mkHTTPClient(*masterURL, *timeout, auth, certPool, certs), slaveAttributeLabels)); err != nil {
-				log.WithField("error", err).Fatal("Prometheus Register() error")
+	case *srvRecord != "":
+		log.WithField("address", *addr).Info("Exposing metrics of masters discovered via DNS SRV")
+
+		masters, err := newSRVEndpoints(*srvRecord, *srvScheme, *srvRefresh)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"record": *srvRecord,
+				"error":  err,
+			}).Fatal("Error resolving SRV record")
+		}
+
+		if err := registerMasterCollectors(context.Background(), registry, func(m *targetMetrics) fetcher {
+			client := mkHTTPClient("", httpOpts.withMetrics(m), auth, certPool, certs)
+			client.failover = masters
+			return client
+		}, masterOpts); err != nil {
+			log.WithField("error", err).Fatal("Error registering master collectors")
+		}
+
+	case *zkURL != "":
+		log.WithField("address", *addr).Info("Exposing metrics of the leading master discovered via ZooKeeper")
+
+		masters, err := newZKEndpoints(*zkURL, *zkScheme)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"zk":    *zkURL,
+				"error": err,
+			}).Fatal("Error discovering leading master")
+		}
+
+		if err := registerMasterCollectors(context.Background(), registry, func(m *targetMetrics) fetcher {
+			client := mkHTTPClient("", httpOpts.withMetrics(m), auth, certPool, certs)
+			client.failover = masters
+			return client
+		}, masterOpts); err != nil {
+			log.WithField("error", err).Fatal("Error registering master collectors")
+		}
+
+	case *mastersFile != "":
+		log.WithField("address", *addr).Info("Exposing metrics of multiple masters")
+
+		targets, err := loadMasterTargets(*mastersFile)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"file":  *mastersFile,
+				"error": err,
+			}).Fatal("Error loading masters")
+		}
+		if *tokenFilePath != "" {
+			log.Fatal("-tokenFile doesn't apply to -masters, give the masters their own tokenFile instead")
+		}
+
+		for _, target := range targets {
+			url := target.URL
+			targetAuth, err := target.authInfo(*loginURL, *authScheme, *tokenFileRefresh)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"cluster": target.Cluster,
+					"file":    target.TokenFile,
+					"error":   err,
+				}).Fatal("Error reading token file")
+			}
+			targetCertPool, targetCerts := target.tlsConfig()
+			if targetAuth.strictMode {
+				if err := checkStrictMode(mkHTTPClient(url, httpOpts, targetAuth, targetCertPool, targetCerts)); err != nil {
+					log.WithFields(log.Fields{
+						"cluster": target.Cluster,
+						"error":   err,
+					}).Fatal("Invalid strict mode configuration")
+				}
 			}
+
+			registry := prometheus.NewRegistry()
+			if err := registerMasterCollectors(context.Background(), registry, func(m *targetMetrics) fetcher {
+				return mkHTTPClient(url, httpOpts.withMetrics(m), targetAuth, targetCertPool, targetCerts)
+			}, masterOpts); err != nil {
+				log.WithField("error", err).Fatal("Error registering master collectors")
+			}
+			gatherers = append(gatherers, newLabeledGatherer(registry, prometheus.Labels{"cluster": target.Cluster}))
 		}
 
 	case *slaveURL != "":
 		log.WithField("address", *addr).Info("Exposing slave metrics")
 
-		slaveCollectors := []func(*httpClient) prometheus.Collector{
-			func(c *httpClient) prometheus.Collector {
-				return newSlaveCollector(c)
+		slaveCollectors := map[string]func(*httpClient) prometheus.Collector{
+			"slave": func(c *httpClient) prometheus.Collector {
+				return newSlaveCollector(c, collectorOpts)
 			},
-			func(c *httpClient) prometheus.Collector {
+			"slave_monitor": func(c *httpClient) prometheus.Collector {
 				return newSlaveMonitorCollector(c)
 			},
-			func(c *httpClient) prometheus.Collector {
+			"slave_state": func(c *httpClient) prometheus.Collector {
 				return newSlaveStateCollector(c, slaveTaskLabels, slaveAttributeLabels)
 			},
 		}
-
-		for _, f := range slaveCollectors {
-			if err := prometheus.Register(
-				f(mkHTTPClient(*slaveURL, *timeout, auth, certPool, certs))); err != nil {
+		if *enableSlaveContainers {
+			slaveCollectors["slave_containers"] = func(c *httpClient) prometheus.Collector {
+				return newSlaveContainersCollector(c)
+			}
+		}
+		if *enableSlaveFlags {
+			exportedFlags := csvInputToList(*exportedSlaveFlags)
+			slaveCollectors["slave_flags"] = func(c *httpClient) prometheus.Collector {
+				return newSlaveFlagsCollector(c, exportedFlags)
+			}
+		}
+		setCollectorsEnabled(map[string]bool{
+			"slave":            true,
+			"slave_monitor":    true,
+			"slave_state":      true,
+			"slave_containers": *enableSlaveContainers,
+			"slave_flags":      *enableSlaveFlags,
+		})
+
+		if *apiVersion == "v1" {
+			log.Warn("-apiVersion v1 only applies to masters, agents are fetched from the v0 API")
+		}
+		if httpOpts.debugState != nil {
+			log.Warn("-enableDebugState only keeps the /state responses of masters, it has no effect with -slave")
+			httpOpts.debugState = nil
+		}
+		metrics, err := newTargetMetrics(registry, false)
+		if err != nil {
+			log.WithField("error", err).Fatal("Prometheus Register() error")
+		}
+		for name, f := range slaveCollectors {
+			if err := registry.Register(newTimedCollector(name,
+				f(mkAgentHTTPClient(*slaveURL, httpOpts.withMetrics(metrics), auth, certPool, certs)))); err != nil {
 				log.WithField("error", err).Fatal("Prometheus Register() error")
 			}
 		}
 
+	case *fixtureDir != "":
+		log.WithFields(log.Fields{
+			"address": *addr,
+			"dir":     *fixtureDir,
+		}).Info("Exposing master metrics read from fixtures")
+
+		if masterOpts.enableSlaveVersions {
+			log.Warn("-enableSlaveVersions has no effect with -fixtureDir")
+			masterOpts.enableSlaveVersions = false
+		}
+		if err := registerMasterCollectors(context.Background(), registry, func(m *targetMetrics) fetcher {
+			return fixtureFetcher{dir: *fixtureDir, metrics: m}
+		}, masterOpts); err != nil {
+			log.WithField("error", err).Fatal("Error registering master collectors")
+		}
+
+	case *enableProbe:
+		log.WithField("address", *addr).Info("Exposing master metrics on /probe only")
+
 	default:
-		log.Fatal("Either -master or -slave is required")
+		log.Fatal("One of -master, -slave, -masters, -srvRecord, -zk, -fixtureDir or -enableProbe is required")
+	}
+
+	exposed, err := newFilteredGatherer(gatherers, *metricsKeepRegex, *metricsDropRegex)
+	if err != nil {
+		log.WithField("error", err).Fatal("Invalid -metricsKeepRegex or -metricsDropRegex")
+	}
+
+	if *warmup {
+		log.Info("Collecting metrics to warm up")
+		if failed := warmUp(gatherers); len(failed) > 0 {
+			fields := log.Fields{"endpoints": strings.Join(failed, ",")}
+			if *warmupRequired {
+				log.WithFields(fields).Fatal("Error fetching endpoints on warm-up")
+			}
+			log.WithFields(fields).Warn("Error fetching endpoints on warm-up")
+		}
 	}
 
 	log.Info("Listening and serving ...")
@@ -286,7 +985,27 @@ func main() {
             </html>`))
 	})
 
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", withScrapeID(httpOpts.scrape.handler(promhttp.HandlerFor(exposed, promhttp.HandlerOpts{}))))
+	if *enableProbe {
+		if masterOpts.stateRefreshInterval > 0 {
+			log.Warn("-stateRefreshInterval doesn't apply to /probe, whose targets are fetched on every probe")
+		}
+		http.Handle("/probe", withScrapeID(newProbeHandler(func(url string, m *targetMetrics, credentials bool) *httpClient {
+			// The states of probe targets aren't kept, as any master
+			// may be probed.
+			opts := httpOpts.withMetrics(m)
+			opts.debugState = nil
+			if !credentials {
+				// The headers may carry credentials as well.
+				opts.headers = nil
+				return mkHTTPClient(url, opts, authInfo{skipSSLVerify: auth.skipSSLVerify}, certPool, nil)
+			}
+			return mkHTTPClient(url, opts, auth, certPool, certs)
+		}, masterOpts, csvInputToList(*probeAllowedTargets), *probeMaxTargets)))
+	}
+	if httpOpts.debugState != nil {
+		http.Handle("/debug/state", httpOpts.debugState)
+	}
 	if err := http.ListenAndServe(*addr, nil); err != nil {
 		log.WithField("error", err).Fatal("listen and serve error")
 	}
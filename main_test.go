@@ -1,9 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestPortRange_UnmarshalJSON(t *testing.T) {
@@ -27,3 +46,565 @@ func TestPortRange_UnmarshalJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestRanges_Bounds(t *testing.T) {
+	for _, tt := range []struct {
+		rs       ranges
+		min, max uint64
+		ok       bool
+	}{
+		{nil, 0, 0, false},
+		{ranges{{31000, 32000}}, 31000, 32000, true},
+		{ranges{{31500, 32000}, {80, 80}, {31000, 31100}}, 80, 32000, true},
+	} {
+		if min, max, ok := tt.rs.bounds(); min != tt.min || max != tt.max || ok != tt.ok {
+			t.Errorf("%v: got %d, %d, %v, want %d, %d, %v", tt.rs, min, max, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
+
+func TestRanges_Without(t *testing.T) {
+	for _, tt := range []struct {
+		rs, other ranges
+		want      ranges
+	}{
+		{ranges{{31000, 32000}}, nil, ranges{{31000, 32000}}},
+		{ranges{{31000, 32000}}, ranges{{31000, 32000}}, nil},
+		{ranges{{31000, 32000}}, ranges{{31500, 31500}, {31000, 31099}}, ranges{{31100, 31499}, {31501, 32000}}},
+		{ranges{{31000, 31100}, {80, 90}}, ranges{{85, 31050}}, ranges{{80, 84}, {31051, 31100}}},
+		{ranges{{31000, 31100}}, ranges{{30000, 31000}, {31100, 33000}}, ranges{{31001, 31099}}},
+	} {
+		if got := tt.rs.without(tt.other); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v without %v: got %v, want %v", tt.rs, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestResources_UnmarshalJSON(t *testing.T) {
+	for i, tt := range []struct {
+		data  string
+		want  resources
+		valid bool
+	}{
+		{`{"cpus": 2.0, "mem": 1024, "disk": 10}`, resources{CPUs: 2, Mem: 1024, Disk: 10}, true},
+		{`{"cpus": "2.0", "mem": "1024", "ports": "[31000-31001]"}`, resources{CPUs: 2, Mem: 1024, Ports: ranges{{31000, 31001}}}, true},
+		{`{"cpus": 8, "gpus": 2}`, resources{CPUs: 8, GPUs: 2}, true},
+		{`{"cpus": null}`, resources{}, true},
+		{`{"cpus": {"value": 2, "role": "web"}, "cpus(web)": 2, "mem": {"value": "1024"}}`, resources{CPUs: 2, Mem: 1024}, true},
+		{`{"cpus": {"value": "two"}}`, resources{}, false},
+		{`{"cpus": "two"}`, resources{}, false},
+	} {
+		var r resources
+		err := json.Unmarshal([]byte(tt.data), &r)
+		if (err == nil) != tt.valid {
+			t.Errorf("test #%d: got err: %v, want valid: %v", i, err, tt.valid)
+		}
+		if tt.valid && !reflect.DeepEqual(r, tt.want) {
+			t.Errorf("test #%d: got: %+v, want: %+v", i, r, tt.want)
+		}
+	}
+}
+
+func TestCheckStrictMode(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	for i, tt := range []struct {
+		key      []byte
+		loginURL string
+		valid    bool
+	}{
+		{pemKey, "https://leader.mesos/acs/api/v1/auth/login", true},
+		{[]byte("not a key"), "https://leader.mesos/acs/api/v1/auth/login", false},
+		{pemKey, "leader.mesos/acs/api/v1/auth/login", false},
+		{pemKey, "", false},
+	} {
+		client := &httpClient{auth: authInfo{signingKey: tt.key, loginURL: tt.loginURL}}
+		if err := checkStrictMode(client); (err == nil) != tt.valid {
+			t.Errorf("test #%d: got err: %v, want valid: %v", i, err, tt.valid)
+		}
+	}
+}
+
+func TestAuthToken_Healthy(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	for _, tt := range []struct {
+		status int
+		body   string
+		want   float64
+	}{
+		{http.StatusOK, `{"token": "abc"}`, 1},
+		{http.StatusUnauthorized, `{"title": "Invalid credentials"}`, 0},
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		metrics, err := newTargetMetrics(prometheus.NewRegistry(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics.enableAuth()
+		client := &httpClient{auth: authInfo{signingKey: pemKey, loginURL: ts.URL}, metrics: metrics}
+		authToken(client)
+		ts.Close()
+
+		var pb dto.Metric
+		metrics.authHealthy.Write(&pb)
+		if got := pb.GetGauge().GetValue(); got != tt.want {
+			t.Errorf("%s: got auth_healthy %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestAuthToken_LoginTimeout(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer ts.Close()
+	defer close(hang)
+
+	client := &httpClient{
+		Client:       http.Client{Timeout: time.Minute},
+		auth:         authInfo{signingKey: pemKey, loginURL: ts.URL},
+		loginTimeout: 50 * time.Millisecond,
+	}
+	start := time.Now()
+	if token := authToken(client); token != "" {
+		t.Errorf("got token %q, want none", token)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("login took %s, want about 50ms", elapsed)
+	}
+}
+
+func TestRequest_TokenRejected(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	logins, rejected := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login":
+			logins++
+			json.NewEncoder(w).Encode(tokenResponse{Token: fmt.Sprintf("t%d", logins)})
+		// The first token is revoked by the time it is used.
+		case r.Header.Get("Authorization") != "token=t2":
+			rejected++
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/flags":
+			w.Write([]byte(`{"flags": {"roles": "web"}}`))
+		default:
+			w.Write([]byte(`{"version": "1.7.2"}`))
+		}
+	}))
+	defer ts.Close()
+
+	client := &httpClient{
+		Client: *ts.Client(),
+		url:    ts.URL,
+		auth:   authInfo{strictMode: true, signingKey: pemKey, loginURL: ts.URL + "/login"},
+	}
+	for _, c := range []prometheus.Collector{
+		newMasterFlagsCollector(client, []string{"roles"}),
+		newVersionCollector(client, collectorOptions{}),
+	} {
+		if got := len(collectMetrics(c)); got != 1 {
+			t.Errorf("got %d metrics, want 1", got)
+		}
+	}
+	if logins != 2 || rejected != 1 {
+		t.Errorf("got %d logins and %d rejected requests, want 2 and 1", logins, rejected)
+	}
+}
+
+func TestRequest_ConcurrentLogins(t *testing.T) {
+	// Collectors share the client, and so its token, which logging in
+	// again replaces while others send requests. Run with -race.
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var mu sync.Mutex
+	logins := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/login" {
+			logins++
+			json.NewEncoder(w).Encode(tokenResponse{Token: fmt.Sprintf("t%d", logins)})
+			return
+		}
+		// Every token is revoked once used, so requests keep logging in.
+		if r.Header.Get("Authorization") != fmt.Sprintf("token=t%d", logins) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		logins++
+		w.Write([]byte(`{"version": "1.7.2"}`))
+	}))
+	defer ts.Close()
+
+	client := &httpClient{
+		Client: *ts.Client(),
+		url:    ts.URL,
+		auth:   authInfo{strictMode: true, signingKey: pemKey, loginURL: ts.URL + "/login"},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				var v versionFields
+				client.fetchAndDecode("/version", &v)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHeaderFlag_Set(t *testing.T) {
+	f, err := ioutil.TempFile("", "header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("secret\n")
+	f.Close()
+
+	h := headerFlag{}
+	for _, value := range []string{"X-Forwarded-Access-Token: abc", "Cookie: @" + f.Name(), "cookie:b=c"} {
+		if err := h.Set(value); err != nil {
+			t.Errorf("%q: got err: %v", value, err)
+		}
+	}
+	want := headerFlag{"X-Forwarded-Access-Token": {"abc"}, "Cookie": {"secret", "b=c"}}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("got: %v, want: %v", h, want)
+	}
+
+	for _, value := range []string{"no colon", ": value", "X-Token: @/nonexistent"} {
+		if err := h.Set(value); err == nil {
+			t.Errorf("%q: got no error", value)
+		}
+	}
+	if got := http.Header(h).Get("X-Token"); got != "" {
+		t.Errorf("got X-Token %q from a failed Set", got)
+	}
+}
+
+func TestValidHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"mesos.example.com":      true,
+		"mesos.example.com:5050": true,
+		"10.0.0.1":               true,
+		"[::1]:5050":             true,
+		"":                       false,
+		"mesos.example.com/path": false,
+		"user@mesos.example.com": false,
+		"mesos example":          false,
+		":5050":                  false,
+	} {
+		if got := validHost(host); got != want {
+			t.Errorf("%q: got %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestRequest_HostHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(versionFields{Version: r.Host})
+	}))
+	defer ts.Close()
+
+	client := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, hostHeader: "mesos.example.com"}, authInfo{}, nil, nil)
+	var vf versionFields
+	if !client.fetchAndDecode("/version", &vf) || vf.Version != "mesos.example.com" {
+		t.Errorf("got Host %q from the master, want mesos.example.com", vf.Version)
+	}
+	// Agents are fetched with the host of their URL.
+	agent := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	if ok, _ := client.request(agent, "/slave/version", "GET", "/version", nil, &vf, nil); !ok || vf.Version == "mesos.example.com" {
+		t.Errorf("got Host %q from an agent, want the host of its URL", vf.Version)
+	}
+}
+
+func TestRequest_SlaveAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(versionFields{Version: r.Header.Get("Authorization")})
+	}))
+	defer ts.Close()
+	agent := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	auth := authInfo{username: "user", password: "secret"}
+
+	for _, slaveAuth := range []bool{false, true} {
+		client := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, slaveAuth: slaveAuth}, auth, nil, nil)
+		var vf versionFields
+		if !client.fetchAndDecode("/version", &vf) || vf.Version == "" {
+			t.Errorf("slaveAuth %v: got no credentials sent to the master", slaveAuth)
+		}
+		vf = versionFields{}
+		if ok, _ := client.request(agent, "/slave/version", "GET", "/version", nil, &vf, nil); !ok || (vf.Version != "") != slaveAuth {
+			t.Errorf("slaveAuth %v: got Authorization %q sent to an agent", slaveAuth, vf.Version)
+		}
+	}
+}
+
+func TestMkHTTPClient_UnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "mesos.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets not supported: %s", err)
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": "1.7.2"}`))
+	}))
+	defer l.Close()
+
+	client := mkHTTPClient("unix://"+socket, httpOptions{timeout: time.Second}, authInfo{}, nil, nil)
+	var vf versionFields
+	if !client.fetchAndDecode("/version", &vf) || vf.Version != "1.7.2" {
+		t.Errorf("got version %q, want 1.7.2", vf.Version)
+	}
+}
+
+func TestMkHTTPClient_IPv6(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 not supported: %s", err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(versionFields{Version: r.URL.Path})
+	}))
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	for _, tt := range []struct {
+		url  string
+		want string
+	}{
+		{"http://[::1]:" + port, "/version"},
+		{"http://[::1]:" + port + "/", "/version"},
+		{"http://[::1]:" + port + "/mesos", "/mesos/version"},
+		{"http://[0:0:0:0:0:0:0:1]:" + port, "/version"},
+	} {
+		client := mkHTTPClient(tt.url, httpOptions{timeout: time.Second}, authInfo{}, nil, nil)
+		var vf versionFields
+		if !client.fetchAndDecode("/version", &vf) || vf.Version != tt.want {
+			t.Errorf("%s: got path %q, want %s", tt.url, vf.Version, tt.want)
+		}
+	}
+}
+
+func TestMkHTTPClient_HTTP2(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(versionFields{Version: r.Proto})
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		disableHTTP2 bool
+		want         string
+	}{
+		{false, "HTTP/2.0"},
+		{true, "HTTP/1.1"},
+	} {
+		opts := httpOptions{timeout: time.Second, disableHTTP2: tt.disableHTTP2}
+		client := mkHTTPClient(ts.URL, opts, authInfo{skipSSLVerify: true}, nil, nil)
+		var vf versionFields
+		if !client.fetchAndDecode("/version", &vf) || vf.Version != tt.want {
+			t.Errorf("disableHTTP2=%v: got protocol %q, want %s", tt.disableHTTP2, vf.Version, tt.want)
+		}
+	}
+}
+
+func TestMkAgentHTTPClient_APIVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/state" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"id": "agent1"}`))
+	}))
+	defer ts.Close()
+
+	client := mkAgentHTTPClient(ts.URL, httpOptions{timeout: time.Second, apiVersion: "v1"}, authInfo{}, nil, nil)
+	var s slaveState
+	if !client.fetchAndDecode("/state", &s) {
+		t.Error("got a failure fetching the agent /state with -apiVersion v1")
+	}
+}
+
+func TestMkHTTPClient_FailOnRedirect(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			json.NewEncoder(w).Encode(versionFields{Version: "login"})
+			return
+		}
+		json.NewEncoder(w).Encode(versionFields{Version: "leader"})
+	}))
+	defer leader.Close()
+	// A master which isn't leading redirects to the leader, while a
+	// misrouting proxy redirects elsewhere.
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, leader.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer follower.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, leader.URL+"/login", http.StatusTemporaryRedirect)
+	}))
+	defer proxy.Close()
+
+	for _, tt := range []struct {
+		url            string
+		failOnRedirect bool
+		want           string
+	}{
+		{follower.URL, true, "leader"},
+		{proxy.URL, true, ""},
+		{proxy.URL, false, "login"},
+	} {
+		client := mkHTTPClient(tt.url, httpOptions{timeout: time.Second, failOnRedirect: tt.failOnRedirect}, authInfo{}, nil, nil)
+		var vf versionFields
+		if ok := client.fetchAndDecode("/version", &vf); ok != (tt.want != "") || vf.Version != tt.want {
+			t.Errorf("%s failOnRedirect=%v: got %v %q, want %q", tt.url, tt.failOnRedirect, ok, vf.Version, tt.want)
+		}
+	}
+}
+
+func TestRegisterMasterCollectors_Enabled(t *testing.T) {
+	err := registerMasterCollectors(context.Background(), prometheus.NewRegistry(), func(m *targetMetrics) fetcher {
+		return mkHTTPClient("http://localhost:5050", httpOptions{metrics: m}, authInfo{}, nil, nil)
+	}, masterOptions{enableMasterState: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for collector, want := range map[string]float64{
+		"master":       1,
+		"master_state": 1,
+		"master_flags": 0,
+		"quota":        0,
+	} {
+		var pb dto.Metric
+		collectorEnabled.WithLabelValues(collector).Write(&pb)
+		if got := pb.GetGauge().GetValue(); got != want {
+			t.Errorf("%s: got %v, want %v", collector, got, want)
+		}
+	}
+}
+
+func TestRegisterMasterCollectors_Error(t *testing.T) {
+	err := registerMasterCollectors(context.Background(), prometheus.NewRegistry(), func(m *targetMetrics) fetcher {
+		return fixtureFetcher{dir: "fixtures", metrics: m}
+	}, masterOptions{enableSlaveVersions: true})
+	if err == nil {
+		t.Error("got no error for -enableSlaveVersions with fixtures")
+	}
+}
+
+func TestRegistry_GoRuntime(t *testing.T) {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "go_goroutines" {
+			return
+		}
+	}
+	t.Error("go_goroutines not registered")
+}
+
+func TestWarmUp(t *testing.T) {
+	// Two clusters, each with its own metrics, which failed /state both.
+	var gatherers prometheus.Gatherers
+	for cluster, failed := range map[string][]string{
+		"a": {"/state", "/flags"},
+		"b": {"/state"},
+	} {
+		r := prometheus.NewRegistry()
+		metrics, err := newTargetMetrics(r, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics.fetched("/metrics/snapshot", true)
+		for _, endpoint := range failed {
+			metrics.fetched(endpoint, false)
+		}
+		gatherers = append(gatherers, newLabeledGatherer(r, prometheus.Labels{"cluster": cluster}))
+	}
+
+	want := []string{"/flags", "/state"}
+	if got := warmUp(gatherers); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestHashFlags(t *testing.T) {
+	hash := func(args ...string) uint32 {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("master", "", "")
+		fs.String("slave", "", "")
+		fs.String("password", "", "")
+		fs.Var(headerFlag{}, "header", "")
+		fs.Duration("timeout", 5*time.Second, "")
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return hashFlags(fs)
+	}
+
+	base := hash("-master", "http://mesos:5050")
+	if got := hash("-master", "http://mesos:5050"); got != base {
+		t.Errorf("same flags: got %d, want %d", got, base)
+	}
+	if got := hash("-timeout", "5s", "-master", "http://mesos:5050"); got != base {
+		t.Errorf("default passed explicitly: got %d, want %d", got, base)
+	}
+	if got := hash("-master", "http://mesos:5050", "-password", "secret"); got != base {
+		t.Errorf("password: got %d, want %d", got, base)
+	}
+	if got := hash("-master", "http://mesos:5050", "-header", "Authorization: token"); got != base {
+		t.Errorf("header: got %d, want %d", got, base)
+	}
+	if got := hash("-master", "http://mesos:5050", "-timeout", "10s"); got == base {
+		t.Errorf("different timeout: got the same hash %d", got)
+	}
+
+	// Agents differ by their URL alone.
+	if a, b := hash("-slave", "http://agent1:5051"), hash("-slave", "http://agent2:5051"); a != b {
+		t.Errorf("different slaves: got hashes %d and %d, want the same", a, b)
+	}
+}
@@ -8,8 +8,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func newMasterCollector(httpClient *httpClient) prometheus.Collector {
+func newMasterCollector(fetcher fetcher, opts collectorOptions) prometheus.Collector {
 	framework_re := regexp.MustCompile(`^master/frameworks/(?P<name>[^/]+)/(?P<id>[^/]+)/(?P<type>[^/]+)(?:/(?P<subtype>.+$))?`)
+	messages_re := regexp.MustCompile(`^master/messages_(?P<type>.+)$`)
 
 	visitFrameworkMatches := func(m metricMap, visitor func(string, string, string, string, float64)) {
 		for key, value := range m {
@@ -217,9 +218,10 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 		},
 
 		counter("master", "recovery_slave_removal_events_total", "Total number of recovery removal events on this master since it booted.", "event"): func(m metricMap, c prometheus.Collector) error {
-			removals, ok := m["master/recovery_slave_removals"]
-			if !ok {
-				log.WithField("metric", "master/recovery_slave_removals").Warn(LogErrNotFoundInMap)
+			// Not reported by every Mesos version
+			removals, err := m.optional("master/recovery_slave_removals")
+			if err != nil {
+				return err
 			}
 			c.(*settableCounterVec).Set(removals, "removal")
 			return nil
@@ -356,6 +358,45 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			c.(prometheus.Gauge).Set(offers)
 			return nil
 		},
+		prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos",
+			Subsystem: "master",
+			Name:      "slaves_active",
+			Help:      "Current number of active slaves registered with the master.",
+		}): func(m metricMap, c prometheus.Collector) error {
+			slaves, err := m.optional("master/slaves_active")
+			if err != nil {
+				return err
+			}
+			c.(prometheus.Gauge).Set(slaves)
+			return nil
+		},
+		prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos",
+			Subsystem: "master",
+			Name:      "slaves_inactive",
+			Help:      "Current number of inactive slaves registered with the master.",
+		}): func(m metricMap, c prometheus.Collector) error {
+			slaves, err := m.optional("master/slaves_inactive")
+			if err != nil {
+				return err
+			}
+			c.(prometheus.Gauge).Set(slaves)
+			return nil
+		},
+		prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos",
+			Subsystem: "master",
+			Name:      "slaves_disconnected",
+			Help:      "Current number of slaves registered with the master but disconnected from it.",
+		}): func(m metricMap, c prometheus.Collector) error {
+			slaves, err := m.optional("master/slaves_disconnected")
+			if err != nil {
+				return err
+			}
+			c.(prometheus.Gauge).Set(slaves)
+			return nil
+		},
 
 		// Master stats about tasks
 		counter("master", "task_states_exit_total", "Total number of tasks processed by exit state.", "state"): func(m metricMap, c prometheus.Collector) error {
@@ -574,6 +615,16 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			c.(*settableCounterVec).Set(updateSlave, "update_slave")
 			return nil
 		},
+		// Covers every message type the master reports, including the
+		// ones missing from mesos_master_messages
+		counter("master", "messages_total", "Total number of messages received by the master by type.", "type"): func(m metricMap, c prometheus.Collector) error {
+			for key, value := range m {
+				if match := messages_re.FindStringSubmatch(key); match != nil {
+					c.(*settableCounterVec).Set(value, match[1])
+				}
+			}
+			return nil
+		},
 
 		counter("master", "messages_outcomes_total",
 			"Total number of messages by outcome of operation and direction.",
@@ -804,7 +855,7 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			c.(prometheus.Gauge).Set(count)
 			return nil
 		},
-		gauge("master", "allocator_offer_filters_active", "Number of active offer filters for all frameworks within the role", "role"): func(m metricMap, c prometheus.Collector) error {
+		gauge("master", "allocator_offer_filters_active", "Number of active offer filters for all frameworks within the role", opts.roleLabels("role")...): func(m metricMap, c prometheus.Collector) error {
 			re, err := regexp.Compile("allocator/mesos/offer_filters/roles/(.*?)/active")
 			if err != nil {
 				log.WithFields(log.Fields{
@@ -820,12 +871,12 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 					continue
 				}
 				role := matches[1]
-				c.(*prometheus.GaugeVec).WithLabelValues(role).Set(value)
+				c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role)...).Set(value)
 			}
 			return nil
 		},
 
-		gauge("master", "allocator_role_quota_offered_or_allocated", "Amount of resources considered offered or allocated towards a role's quota guarantee.", "role", "resource"): func(m metricMap, c prometheus.Collector) error {
+		gauge("master", "allocator_role_quota_offered_or_allocated", "Amount of resources considered offered or allocated towards a role's quota guarantee.", opts.roleLabels("role", "resource")...): func(m metricMap, c prometheus.Collector) error {
 			re, err := regexp.Compile("allocator/mesos/quota/roles/(.*?)/resources/(.*?)/offered_or_allocated")
 			if err != nil {
 				log.WithFields(log.Fields{
@@ -842,12 +893,12 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 				}
 				role := matches[1]
 				resource := matches[2]
-				c.(*prometheus.GaugeVec).WithLabelValues(role, resource).Set(value)
+				c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role, resource)...).Set(value)
 			}
 			return nil
 		},
 
-		gauge("master", "allocator_role_shares_dominant", "Dominance factor for a role", "role"): func(m metricMap, c prometheus.Collector) error {
+		gauge("master", "allocator_role_shares_dominant", "Dominance factor for a role", opts.roleLabels("role")...): func(m metricMap, c prometheus.Collector) error {
 			re, err := regexp.Compile("allocator/mesos/roles/(.*?)/shares/dominant")
 			if err != nil {
 				log.WithFields(log.Fields{
@@ -863,12 +914,12 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 					continue
 				}
 				role := matches[1]
-				c.(*prometheus.GaugeVec).WithLabelValues(role).Set(value)
+				c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role)...).Set(value)
 			}
 			return nil
 		},
 
-		gauge("master", "allocator_role_quota_guarantee", "Amount of resources guaranteed for a role via quota", "role", "resource"): func(m metricMap, c prometheus.Collector) error {
+		gauge("master", "allocator_role_quota_guarantee", "Amount of resources guaranteed for a role via quota", opts.roleLabels("role", "resource")...): func(m metricMap, c prometheus.Collector) error {
 			re, err := regexp.Compile("allocator/mesos/quota/roles/(.*?)/resources/(.*?)/guarantee")
 			if err != nil {
 				log.WithFields(log.Fields{
@@ -885,7 +936,7 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 				}
 				role := matches[1]
 				resource := matches[2]
-				c.(*prometheus.GaugeVec).WithLabelValues(role, resource).Set(value)
+				c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role, resource)...).Set(value)
 			}
 			return nil
 		},
@@ -980,9 +1031,9 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			Name:      "queued_operations",
 			Help:      "Number of operations in the registry queue",
 		}): func(m metricMap, c prometheus.Collector) error {
-			ops, ok := m["registrar/queued_operations"]
-			if !ok {
-				log.WithField("metric", "registrar/queued_operations").Warn(LogErrNotFoundInMap)
+			ops, err := m.optional("registrar/queued_operations")
+			if err != nil {
+				return err
 			}
 			c.(prometheus.Gauge).Set(ops)
 			return nil
@@ -1072,9 +1123,9 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			Name:      "log_recovered",
 			Help:      "Recovered status of the registrar log",
 		}): func(m metricMap, c prometheus.Collector) error {
-			recovered, ok := m["registrar/log/recovered"]
-			if !ok {
-				log.WithField("metric", "registrar/log/recovered").Warn(LogErrNotFoundInMap)
+			recovered, err := m.optional("registrar/log/recovered")
+			if err != nil {
+				return err
 			}
 			c.(prometheus.Gauge).Set(recovered)
 			return nil
@@ -1085,9 +1136,9 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			Name:      "log_ensemble_size",
 			Help:      "Ensemble size of the registrar log",
 		}): func(m metricMap, c prometheus.Collector) error {
-			size, ok := m["registrar/log/ensemble_size"]
-			if !ok {
-				log.WithField("metric", "registrar/log/ensemble_size").Warn(LogErrNotFoundInMap)
+			size, err := m.optional("registrar/log/ensemble_size")
+			if err != nil {
+				return err
 			}
 			c.(prometheus.Gauge).Set(size)
 			return nil
@@ -1172,6 +1223,34 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			)
 			return nil
 		},
+		gauge("framework", "offer_decline_ratio", "Fraction of the offers answered by the framework which it declined", "framework_name", "framework_id"): func(m metricMap, c prometheus.Collector) error {
+			type offers struct{ accepted, declined float64 }
+			frameworks := map[[2]string]*offers{}
+			visitFrameworkMatches(m,
+				func(framework string, framework_id string, type1 string, type2 string, value float64) {
+					if type1 != "offers" {
+						return
+					}
+					key := [2]string{framework, framework_id}
+					if frameworks[key] == nil {
+						frameworks[key] = &offers{}
+					}
+					switch type2 {
+					case "accepted":
+						frameworks[key].accepted = value
+					case "declined":
+						frameworks[key].declined = value
+					}
+				},
+			)
+			for key, o := range frameworks {
+				// Frameworks which didn't answer any offer yet have no ratio.
+				if answered := o.accepted + o.declined; answered > 0 {
+					c.(*prometheus.GaugeVec).WithLabelValues(key[0], key[1]).Set(o.declined / answered)
+				}
+			}
+			return nil
+		},
 		gauge("framework", "tasks_active_states", "State of active tasks per", "framework_name", "framework_id", "state"): func(m metricMap, c prometheus.Collector) error {
 			visitFrameworkMatches(m,
 				func(framework string, framework_id string, type1 string, type2 string, value float64) {
@@ -1195,5 +1274,5 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 		// END
 	}
 
-	return newStandardCollector(httpClient, metrics)
+	return newStandardCollector(fetcher, metrics, opts)
 }
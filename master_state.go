@@ -4,42 +4,164 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 )
 
 type (
 	slave struct {
-		PID        string                     `json:"pid"`
-		Hostname   string                     `json:"hostname"`
-		Id         string                     `json:"id"`
-		Port       uint32                     `json:"port"`
-		Used       resources                  `json:"used_resources"`
-		Unreserved resources                  `json:"unreserved_resources"`
-		Total      resources                  `json:"resources"`
-		Attributes map[string]json.RawMessage `json:"attributes"`
+		PID              string                     `json:"pid"`
+		Hostname         string                     `json:"hostname"`
+		Id               string                     `json:"id"`
+		Port             uint32                     `json:"port"`
+		Active           bool                       `json:"active"`
+		RegisteredTime   float64                    `json:"registered_time"`
+		ReregisteredTime float64                    `json:"reregistered_time"`
+		Used             resources                  `json:"used_resources"`
+		Unreserved       resources                  `json:"unreserved_resources"`
+		Total            resources                  `json:"resources"`
+		Reserved         map[string]resources       `json:"reserved_resources"`
+		Attributes       map[string]json.RawMessage `json:"attributes"`
+		// UnreservedFull lists the unreserved resources one by one, which
+		// also tells the revocable ones apart
+		UnreservedFull []resourceInfo `json:"unreserved_resources_full"`
+		// UsedFull lists the used resources one by one along with the role
+		// they are allocated to
+		UsedFull []resourceInfo `json:"used_resources_full"`
+		// TotalFull lists the resources one by one, custom ones included
+		TotalFull []resourceInfo `json:"resources_full"`
 	}
 
 	framework struct {
-		Active    bool   `json:"active"`
-		Tasks     []task `json:"tasks"`
-		Completed []task `json:"completed_tasks"`
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		WebUIURL  string    `json:"webui_url"`
+		Active    bool      `json:"active"`
+		Used      resources `json:"used_resources"`
+		Offered   resources `json:"offered_resources"`
+		Tasks     []task    `json:"tasks"`
+		Completed []task    `json:"completed_tasks"`
+		// Executors lists the custom executors of the framework, not the
+		// command executors Mesos runs tasks without one in
+		Executors []frameworkExecutor `json:"executors"`
+		// ReregisteredTime is only set for frameworks which reregistered
+		ReregisteredTime float64 `json:"reregistered_time"`
+	}
+
+	// frameworkExecutor is an executor of a framework, whose resources are
+	// accounted on top of those of its tasks.
+	frameworkExecutor struct {
+		ID        string    `json:"executor_id"`
+		SlaveID   string    `json:"slave_id"`
+		Resources resources `json:"resources"`
 	}
 
 	state struct {
 		Slaves     []slave     `json:"slaves"`
 		Frameworks []framework `json:"frameworks"`
+		// ElectedTime is only set by the leading master
+		ElectedTime float64 `json:"elected_time"`
+	}
+
+	// masterStateOptions configures the metrics derived from /state.
+	masterStateOptions struct {
+		slaveAttributeLabels []string
+		// slaveReservations enables the per role reservation metrics,
+		// whose cardinality grows with the number of roles
+		slaveReservations bool
+		// clusterReservations enables the per role reservation metrics
+		// summed over all slaves
+		clusterReservations bool
+		// taskHealth enables the health metric of tasks with a health
+		// check, whose cardinality grows with the number of tasks
+		taskHealth bool
+		// taskResources enables the resource metrics of tasks and of their
+		// executors, whose cardinality grows with the number of tasks
+		taskResources bool
+		// slaveResources enables the metric of every scalar resource of
+		// slaves, whose cardinality grows with the custom resources
+		slaveResources bool
+		// slavePortRanges enables the lowest and highest port of slaves
+		slavePortRanges bool
+		// onlyActiveSlaves leaves inactive slaves out of the slave metrics
+		onlyActiveSlaves bool
+		// onlyActiveFrameworks leaves inactive frameworks, and their tasks,
+		// out of the framework and task metrics
+		onlyActiveFrameworks bool
+		// slaveAllocations enables the per role allocation metrics
+		slaveAllocations bool
+		// slaveIPLabel adds the IP address of slaves as an "ip" label
+		slaveIPLabel bool
+		// nodeExporterPort adds a "node_instance" label with the slave
+		// hostname and this port, matching the instance label of
+		// node_exporter, unless zero
+		nodeExporterPort int
+		// frameworkInfo enables the info and resource metrics of
+		// frameworks
+		frameworkInfo bool
+		// maxFrameworks and maxTasks cap the frameworks and tasks the
+		// metrics are derived from, unless zero. Only the number of series
+		// is bounded, /state is still decoded in full.
+		maxFrameworks int
+		maxTasks      int
+		// roundResources is the number of decimals resource values are
+		// rounded to, or negative to leave them as they are
+		roundResources int
 	}
 
 	masterCollector struct {
-		*httpClient
-		metrics map[prometheus.Collector]func(*state, prometheus.Collector)
+		fetcher
+		metrics       map[prometheus.Collector]func(*state, prometheus.Collector)
+		tasksScraped  prometheus.Gauge
+		slavesScraped prometheus.Gauge
+		// leadingSeconds is only collected from the leader
+		leadingSeconds prometheus.Gauge
+		// duplicateSlaves counts the slaves left out for sharing the PID
+		// of another slave
+		duplicateSlaves prometheus.Counter
+		// slavesExcluded is only set with onlyActiveSlaves
+		slavesExcluded prometheus.Gauge
+		// frameworksExcluded is only set with onlyActiveFrameworks
+		frameworksExcluded prometheus.Gauge
+		maxFrameworks      int
+		maxTasks           int
+		// truncated is only set with maxFrameworks or maxTasks
+		truncated *prometheus.CounterVec
 	}
 )
 
-func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []string) prometheus.Collector {
+func newMasterStateCollector(fetcher fetcher, opts masterStateOptions, copts collectorOptions) prometheus.Collector {
+	memUnit := copts.unit()
 	labels := []string{"slave", "hostname", "port", "id"}
+	if opts.slaveIPLabel {
+		labels = append(labels, "ip")
+	}
+	if opts.nodeExporterPort > 0 {
+		labels = append(labels, "node_instance")
+	}
+	slaveLabelValues := func(s slave) []string {
+		values := []string{s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id}
+		if opts.slaveIPLabel {
+			values = append(values, s.ip())
+		}
+		if opts.nodeExporterPort > 0 {
+			values = append(values, net.JoinHostPort(s.Hostname, strconv.Itoa(opts.nodeExporterPort)))
+		}
+		return values
+	}
+	// slaveLabelsWith returns the slave labels followed by extra, for the
+	// slave metrics split further.
+	slaveLabelsWith := func(extra ...string) []string {
+		return append(append([]string{}, labels...), extra...)
+	}
+	round := roundTo(opts.roundResources)
 	metrics := map[prometheus.Collector]func(*state, prometheus.Collector){
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Help:      "Total slave CPUs (fractional)",
@@ -47,18 +169,33 @@ func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []stri
 			Subsystem: "slave",
 			Name:      "cpus",
 		}, labels): func(st *state, c prometheus.Collector) {
+			// Slaves come and go, and inactive ones may be left out.
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Total.CPUs)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(s.Total.CPUs))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Help:      "Used slave CPUs (fractional)",
+			Help:      "Slave CPUs allocated to tasks (fractional), not their actual utilisation",
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      "cpus_allocated",
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(s.Used.CPUs))
+			}
+		},
+		// Misnamed, kept for the dashboards and alerts using it.
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      "Slave CPUs allocated to tasks (fractional). Deprecated, use mesos_slave_cpus_allocated",
 			Namespace: "mesos",
 			Subsystem: "slave",
 			Name:      "cpus_used",
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Used.CPUs)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(s.Used.CPUs))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -67,68 +204,132 @@ func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []stri
 			Subsystem: "slave",
 			Name:      "cpus_unreserved",
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(s.Unreserved.CPUs))
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      "Total slave GPUs",
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      "gpus",
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Unreserved.CPUs)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(s.Total.GPUs))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Help:      "Total slave memory in bytes",
+			Help:      "Slave GPUs allocated to tasks, not their actual utilisation",
 			Namespace: "mesos",
 			Subsystem: "slave",
-			Name:      "mem_bytes",
+			Name:      "gpus_used",
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Total.Mem * 1024)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(s.Used.GPUs))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Help:      "Used slave memory in bytes",
+			Help:      "Unreserved slave GPUs",
 			Namespace: "mesos",
 			Subsystem: "slave",
-			Name:      "mem_used_bytes",
+			Name:      "gpus_unreserved",
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Used.Mem * 1024)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(s.Unreserved.GPUs))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Help:      "Unreserved slave memory in bytes",
+			Help:      memUnit.help("Total slave memory in bytes"),
 			Namespace: "mesos",
 			Subsystem: "slave",
-			Name:      "mem_unreserved_bytes",
+			Name:      memUnit.name("mem_bytes"),
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Unreserved.Mem * 1024)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Total.Mem)))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Help:      "Total slave disk space in bytes",
+			Help:      memUnit.help("Slave memory allocated to tasks in bytes, not its actual utilisation"),
 			Namespace: "mesos",
 			Subsystem: "slave",
-			Name:      "disk_bytes",
+			Name:      memUnit.name("mem_allocated_bytes"),
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Total.Disk * 1024)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Used.Mem)))
 			}
 		},
+		// Misnamed, kept for the dashboards and alerts using it.
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Help:      "Used slave disk space in bytes",
+			Help:      memUnit.help("Slave memory allocated to tasks in bytes. Deprecated, use mesos_slave_" + memUnit.name("mem_allocated_bytes")),
 			Namespace: "mesos",
 			Subsystem: "slave",
-			Name:      "disk_used_bytes",
+			Name:      memUnit.name("mem_used_bytes"),
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Used.Disk * 1024)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Used.Mem)))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Help:      "Unreserved slave disk in bytes",
+			Help:      memUnit.help("Unreserved slave memory in bytes"),
 			Namespace: "mesos",
 			Subsystem: "slave",
-			Name:      "disk_unreserved_bytes",
+			Name:      memUnit.name("mem_unreserved_bytes"),
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(s.Unreserved.Disk * 1024)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Unreserved.Mem)))
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      memUnit.help("Total slave disk space in bytes"),
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      memUnit.name("disk_bytes"),
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Total.Disk)))
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      memUnit.help("Slave disk space allocated to tasks in bytes, not its actual utilisation"),
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      memUnit.name("disk_allocated_bytes"),
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Used.Disk)))
+			}
+		},
+		// Misnamed, kept for the dashboards and alerts using it.
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      memUnit.help("Slave disk space allocated to tasks in bytes. Deprecated, use mesos_slave_" + memUnit.name("disk_allocated_bytes")),
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      memUnit.name("disk_used_bytes"),
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Used.Disk)))
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      memUnit.help("Unreserved slave disk in bytes"),
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      memUnit.name("disk_unreserved_bytes"),
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(s.Unreserved.Disk)))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -137,9 +338,10 @@ func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []stri
 			Subsystem: "slave",
 			Name:      "ports",
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
 				size := s.Total.Ports.size()
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(float64(size))
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(float64(size))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -148,9 +350,10 @@ func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []stri
 			Subsystem: "slave",
 			Name:      "ports_used",
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
 				size := s.Used.Ports.size()
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(float64(size))
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(float64(size))
 			}
 		},
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -159,57 +362,528 @@ func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []stri
 			Subsystem: "slave",
 			Name:      "ports_unreserved",
 		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
 			for _, s := range st.Slaves {
 				size := s.Unreserved.Ports.size()
-				c.(*prometheus.GaugeVec).WithLabelValues(s.PID, s.Hostname, fmt.Sprintf("%d", s.Port), s.Id).Set(float64(size))
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(float64(size))
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      "Number of disjoint ranges of free slave ports, many of which may fail tasks asking for contiguous ports",
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      "ports_fragments",
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				free := s.Total.Ports.without(s.Used.Ports)
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(float64(len(free)))
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      "Unix time at which the slave last registered or reregistered with the master",
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      "registered_time_seconds",
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				registered := s.RegisteredTime
+				if s.ReregisteredTime > registered {
+					registered = s.ReregisteredTime
+				}
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(registered)
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      "Revocable slave CPUs (fractional)",
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      "cpus_revocable",
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(revocableResources(s.UnreservedFull).CPUs))
+			}
+		},
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Help:      memUnit.help("Revocable slave memory in bytes"),
+			Namespace: "mesos",
+			Subsystem: "slave",
+			Name:      memUnit.name("mem_revocable_bytes"),
+		}, labels): func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(round(memUnit.fromMiB(revocableResources(s.UnreservedFull).Mem)))
 			}
 		},
 	}
 
-	if len(slaveAttributeLabels) > 0 {
-		normalisedAttributeLabels := normaliseLabelList(slaveAttributeLabels)
+	metrics[gauge("slave", "tasks", "Current number of tasks on slaves by state", "slave", "state")] = func(st *state, c prometheus.Collector) {
+		// Label tasks by slave PID, like the other slave metrics.
+		pids := map[string]string{}
+		for _, s := range st.Slaves {
+			pids[s.Id] = s.PID
+		}
+		counts := map[[2]string]float64{}
+		for _, f := range st.Frameworks {
+			for _, t := range f.Tasks {
+				pid, ok := pids[t.SlaveID]
+				if !ok {
+					pid = t.SlaveID
+				}
+				counts[[2]string{pid, t.State}]++
+			}
+		}
+		c.(*prometheus.GaugeVec).Reset()
+		for k, n := range counts {
+			c.(*prometheus.GaugeVec).WithLabelValues(k[0], k[1]).Set(n)
+		}
+	}
+
+	if opts.slaveReservations {
+		metrics[gauge("slave", "reserved_cpus", "Slave CPUs reserved by role (fractional)", copts.roleLabels(slaveLabelsWith("role")...)...)] = func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				for role, r := range s.Reserved {
+					c.(*prometheus.GaugeVec).WithLabelValues(copts.roleLabelValues(role, append(slaveLabelValues(s), role)...)...).Set(round(r.CPUs))
+				}
+			}
+		}
+	}
+
+	if opts.slaveResources {
+		metrics[gauge("slave", "resource", "Total slave scalar resources by name, custom resources included", slaveLabelsWith("name")...)] = func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				// Reservations split a resource into several entries.
+				total := map[string]float64{}
+				for _, r := range s.TotalFull {
+					if r.Type == "SCALAR" {
+						total[r.Name] += r.Scalar.Value
+					}
+				}
+				for name, value := range total {
+					c.(*prometheus.GaugeVec).WithLabelValues(append(slaveLabelValues(s), sanitiseLabelValue(name))...).Set(round(value))
+				}
+			}
+		}
+	}
+
+	if opts.slavePortRanges {
+		metrics[gauge("slave", "ports_range_min", "Lowest port of the slave, only exported for slaves with ports", labels...)] = func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				if min, _, ok := s.Total.Ports.bounds(); ok {
+					c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(float64(min))
+				}
+			}
+		}
+		metrics[gauge("slave", "ports_range_max", "Highest port of the slave, only exported for slaves with ports", labels...)] = func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, s := range st.Slaves {
+				if _, max, ok := s.Total.Ports.bounds(); ok {
+					c.(*prometheus.GaugeVec).WithLabelValues(slaveLabelValues(s)...).Set(float64(max))
+				}
+			}
+		}
+	}
+
+	if opts.clusterReservations {
+		metrics[gauge("cluster", "reserved_cpus", "CPUs reserved by role on all slaves (fractional)", copts.roleLabels("role")...)] = func(st *state, c prometheus.Collector) {
+			reserved := map[string]float64{}
+			for _, s := range st.Slaves {
+				for role, r := range s.Reserved {
+					reserved[role] += r.CPUs
+				}
+			}
+			// Roles without reservations left are not exported.
+			c.(*prometheus.GaugeVec).Reset()
+			for role, cpus := range reserved {
+				c.(*prometheus.GaugeVec).WithLabelValues(copts.roleLabelValues(role, role)...).Set(round(cpus))
+			}
+		}
+	}
+
+	if opts.slaveAllocations {
+		// The allocations of a slave add up to its used resources.
+		slaveAllocations := func(get func(resources) float64) func(*state, prometheus.Collector) {
+			return func(st *state, c prometheus.Collector) {
+				c.(*prometheus.GaugeVec).Reset()
+				for _, s := range st.Slaves {
+					byRole := map[string][]resourceInfo{}
+					for _, r := range s.UsedFull {
+						byRole[r.allocationRole()] = append(byRole[r.allocationRole()], r)
+					}
+					for role, rs := range byRole {
+						c.(*prometheus.GaugeVec).WithLabelValues(copts.roleLabelValues(role, s.PID, role)...).Set(round(get(sumResources(rs, false))))
+					}
+				}
+			}
+		}
+		metrics[gauge("slave", "allocated_cpus", "Slave CPUs allocated by role (fractional)", copts.roleLabels("slave", "role")...)] = slaveAllocations(func(rs resources) float64 {
+			return rs.CPUs
+		})
+		metrics[gauge("slave", memUnit.name("allocated_mem_bytes"), memUnit.help("Slave memory allocated by role in bytes"), copts.roleLabels("slave", "role")...)] = slaveAllocations(func(rs resources) float64 {
+			return memUnit.fromMiB(rs.Mem)
+		})
+		metrics[gauge("slave", memUnit.name("allocated_disk_bytes"), memUnit.help("Slave disk space allocated by role in bytes"), copts.roleLabels("slave", "role")...)] = slaveAllocations(func(rs resources) float64 {
+			return memUnit.fromMiB(rs.Disk)
+		})
+	}
+
+	if opts.taskHealth {
+		metrics[gauge("task", "healthy", "1 if the last health check of the task passed, 0 if it failed", "task_id", "framework_id")] = func(st *state, c prometheus.Collector) {
+			// Tasks come and go.
+			c.(*prometheus.GaugeVec).Reset()
+			for _, f := range st.Frameworks {
+				for _, t := range f.Tasks {
+					healthy, ok := t.healthy()
+					if !ok {
+						continue
+					}
+					value := 0.0
+					if healthy {
+						value = 1
+					}
+					c.(*prometheus.GaugeVec).WithLabelValues(sanitiseLabelValue(t.ID), sanitiseLabelValue(t.FrameworkID)).Set(value)
+				}
+			}
+		}
+	}
+
+	if opts.taskResources {
+		// The executor of a task is told by its ID, which is only unique
+		// on a slave, and tasks run by a command executor have none.
+		taskResources := func(ofExecutor bool, get func(resources) float64) func(*state, prometheus.Collector) {
+			return func(st *state, c prometheus.Collector) {
+				// Tasks come and go.
+				c.(*prometheus.GaugeVec).Reset()
+				for _, f := range st.Frameworks {
+					executors := make(map[[2]string]resources, len(f.Executors))
+					for _, e := range f.Executors {
+						executors[[2]string{e.SlaveID, e.ID}] = e.Resources
+					}
+					for _, t := range f.Tasks {
+						rs := t.Resources
+						if ofExecutor {
+							var ok bool
+							if rs, ok = executors[[2]string{t.SlaveID, t.ExecutorID}]; !ok {
+								continue
+							}
+						}
+						c.(*prometheus.GaugeVec).WithLabelValues(sanitiseLabelValue(t.ID), sanitiseLabelValue(t.FrameworkID)).Set(round(get(rs)))
+					}
+				}
+			}
+		}
+		metrics[gauge("task", "cpus", "CPUs of the task (fractional)", "task_id", "framework_id")] = taskResources(false, func(rs resources) float64 {
+			return rs.CPUs
+		})
+		metrics[gauge("task", memUnit.name("mem_bytes"), memUnit.help("Memory of the task in bytes"), "task_id", "framework_id")] = taskResources(false, func(rs resources) float64 {
+			return memUnit.fromMiB(rs.Mem)
+		})
+		metrics[gauge("task", "executor_cpus", "CPUs of the executor of the task, shared with the other tasks of the executor (fractional)", "task_id", "framework_id")] = taskResources(true, func(rs resources) float64 {
+			return rs.CPUs
+		})
+		metrics[gauge("task", memUnit.name("executor_mem_bytes"), memUnit.help("Memory of the executor of the task, shared with the other tasks of the executor, in bytes"), "task_id", "framework_id")] = taskResources(true, func(rs resources) float64 {
+			return memUnit.fromMiB(rs.Mem)
+		})
+	}
+
+	if opts.frameworkInfo {
+		metrics[gauge("framework", "info", "Information about frameworks, always 1", "framework_id", "name", "webui_url")] = func(st *state, c prometheus.Collector) {
+			// Frameworks come and go, and their URL may change.
+			c.(*prometheus.GaugeVec).Reset()
+			for _, f := range st.Frameworks {
+				c.(*prometheus.GaugeVec).WithLabelValues(
+					sanitiseLabelValue(f.ID),
+					sanitiseLabelValue(f.Name),
+					sanitiseLabelValue(f.WebUIURL),
+				).Set(1)
+			}
+		}
+
+		// Tell the resources frameworks use from those they sit on.
+		frameworkResources := func(get func(framework) float64) func(*state, prometheus.Collector) {
+			return func(st *state, c prometheus.Collector) {
+				c.(*prometheus.GaugeVec).Reset()
+				for _, f := range st.Frameworks {
+					c.(*prometheus.GaugeVec).WithLabelValues(sanitiseLabelValue(f.ID)).Set(round(get(f)))
+				}
+			}
+		}
+		metrics[gauge("framework", "used_cpus", "CPUs used by the tasks of the framework (fractional)", "framework_id")] = frameworkResources(func(f framework) float64 {
+			return f.Used.CPUs
+		})
+		metrics[gauge("framework", "offered_cpus", "CPUs offered to the framework and not yet accepted or declined (fractional)", "framework_id")] = frameworkResources(func(f framework) float64 {
+			return f.Offered.CPUs
+		})
+		metrics[gauge("framework", memUnit.name("used_mem_bytes"), memUnit.help("Memory used by the tasks of the framework in bytes"), "framework_id")] = frameworkResources(func(f framework) float64 {
+			return memUnit.fromMiB(f.Used.Mem)
+		})
+		metrics[gauge("framework", memUnit.name("offered_mem_bytes"), memUnit.help("Memory offered to the framework and not yet accepted or declined in bytes"), "framework_id")] = frameworkResources(func(f framework) float64 {
+			return memUnit.fromMiB(f.Offered.Mem)
+		})
+		// The master only retains up to --max_completed_tasks_per_framework.
+		metrics[gauge("framework", "completed_tasks_retained", "Number of completed tasks of the framework retained by the master", "framework_id")] = func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, f := range st.Frameworks {
+				c.(*prometheus.GaugeVec).WithLabelValues(sanitiseLabelValue(f.ID)).Set(float64(len(f.Completed)))
+			}
+		}
+		metrics[gauge("framework", "reregistered_time_seconds", "Unix time at which the framework last reregistered with the master, only exported for frameworks which reregistered", "framework_id")] = func(st *state, c prometheus.Collector) {
+			c.(*prometheus.GaugeVec).Reset()
+			for _, f := range st.Frameworks {
+				if f.ReregisteredTime > 0 {
+					c.(*prometheus.GaugeVec).WithLabelValues(sanitiseLabelValue(f.ID)).Set(f.ReregisteredTime)
+				}
+			}
+		}
+	}
+
+	if len(opts.slaveAttributeLabels) > 0 {
+		normalisedAttributeLabels := normaliseLabelList(opts.slaveAttributeLabels)
 		slaveAttributesLabelsExport := append(labels, normalisedAttributeLabels...)
 
 		metrics[counter("slave", "attributes", "Attributes assigned to slaves", slaveAttributesLabelsExport...)] = func(st *state, c prometheus.Collector) {
+			// Slaves come and go.
+			c.(*settableCounterVec).Reset()
 			for _, s := range st.Slaves {
 				slaveAttributesExport := prometheus.Labels{
 					"slave": s.PID,
 				}
 
 				// User labels
-				for _, label := range normalisedAttributeLabels {
-					slaveAttributesExport[label] = ""
-				}
-				for key, value := range s.Attributes {
-					normalisedLabel := normaliseLabel(key)
-					if stringInSlice(normalisedLabel, normalisedAttributeLabels) {
-						if attribute, err := attributeString(value); err == nil {
-							slaveAttributesExport[normalisedLabel] = attribute
-						}
-					}
-				}
+				attributeLabels(slaveAttributesExport, s.Attributes, normalisedAttributeLabels)
 				c.(*settableCounterVec).Set(1, getLabelValuesFromMap(slaveAttributesExport, slaveAttributesLabelsExport)...)
 			}
 		}
 	}
 
-	return &masterCollector{
-		httpClient: httpClient,
-		metrics:    metrics,
+	c := &masterCollector{
+		fetcher: fetcher,
+		metrics: metrics,
+		tasksScraped: prometheus.NewGauge(prometheus.GaugeOpts{
+			Help:      "Number of tasks (active and completed) decoded from /state in the last scrape",
+			Namespace: "mesos_exporter",
+			Name:      "tasks_scraped",
+		}),
+		slavesScraped: prometheus.NewGauge(prometheus.GaugeOpts{
+			Help:      "Number of slaves decoded from /state in the last scrape",
+			Namespace: "mesos_exporter",
+			Name:      "slaves_scraped",
+		}),
+		leadingSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
+			Help:      "Seconds since the master was elected leader, only exported by the leader with -apiVersion v0",
+			Namespace: "mesos",
+			Subsystem: "master",
+			Name:      "leading_seconds",
+		}),
+		duplicateSlaves: prometheus.NewCounter(prometheus.CounterOpts{
+			Help:      "Total number of slaves from /state left out of the metrics for sharing the PID of another slave",
+			Namespace: "mesos_exporter",
+			Name:      "duplicate_slaves_total",
+		}),
+	}
+	if opts.onlyActiveSlaves {
+		c.slavesExcluded = prometheus.NewGauge(prometheus.GaugeOpts{
+			Help:      "Number of inactive slaves left out of the slave metrics in the last scrape",
+			Namespace: "mesos_exporter",
+			Name:      "slaves_excluded",
+		})
+	}
+	if opts.onlyActiveFrameworks {
+		c.frameworksExcluded = prometheus.NewGauge(prometheus.GaugeOpts{
+			Help:      "Number of inactive frameworks left out of the framework and task metrics in the last scrape",
+			Namespace: "mesos_exporter",
+			Name:      "frameworks_excluded",
+		})
 	}
+	if opts.maxFrameworks > 0 || opts.maxTasks > 0 {
+		c.maxFrameworks = opts.maxFrameworks
+		c.maxTasks = opts.maxTasks
+		c.truncated = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Help:      "Total number of entities from /state left out of the metrics by -maxFrameworks and -maxTasks",
+			Namespace: "mesos_exporter",
+			Name:      "entities_truncated_total",
+		}, []string{"type"})
+	}
+	return c
 }
 
 func (c *masterCollector) Collect(ch chan<- prometheus.Metric) {
 	var s state
 	c.fetchAndDecode("/state", &s)
 
+	for i := range s.Slaves {
+		s.Slaves[i].sanitiseLabels()
+	}
+
+	tasks := 0
+	for _, f := range s.Frameworks {
+		tasks += len(f.Tasks) + len(f.Completed)
+	}
+	c.tasksScraped.Set(float64(tasks))
+	c.slavesScraped.Set(float64(len(s.Slaves)))
+	c.tasksScraped.Collect(ch)
+	c.slavesScraped.Collect(ch)
+
+	// The v1 GET_STATE has no elected_time.
+	if s.ElectedTime > 0 {
+		elected := time.Unix(0, int64(s.ElectedTime*1e9))
+		c.leadingSeconds.Set(time.Since(elected).Seconds())
+		c.leadingSeconds.Collect(ch)
+	}
+
+	s.Slaves = c.dedupSlaves(s.Slaves)
+	c.duplicateSlaves.Collect(ch)
+
+	if c.slavesExcluded != nil {
+		active := s.Slaves[:0]
+		for _, slave := range s.Slaves {
+			if slave.Active {
+				active = append(active, slave)
+			}
+		}
+		c.slavesExcluded.Set(float64(len(s.Slaves) - len(active)))
+		c.slavesExcluded.Collect(ch)
+		s.Slaves = active
+	}
+
+	if c.frameworksExcluded != nil {
+		active := s.Frameworks[:0]
+		for _, framework := range s.Frameworks {
+			if framework.Active {
+				active = append(active, framework)
+			}
+		}
+		c.frameworksExcluded.Set(float64(len(s.Frameworks) - len(active)))
+		c.frameworksExcluded.Collect(ch)
+		s.Frameworks = active
+	}
+
+	if c.truncated != nil {
+		c.truncate(&s)
+		c.truncated.Collect(ch)
+	}
+
 	for c, set := range c.metrics {
 		set(&s, c)
 		c.Collect(ch)
 	}
 }
 
+// truncate drops the frameworks and tasks of s beyond maxFrameworks and
+// maxTasks, in the order the master lists them.
+func (c *masterCollector) truncate(s *state) {
+	if c.maxFrameworks > 0 && len(s.Frameworks) > c.maxFrameworks {
+		c.truncated.WithLabelValues("framework").Add(float64(len(s.Frameworks) - c.maxFrameworks))
+		s.Frameworks = s.Frameworks[:c.maxFrameworks]
+	}
+	if c.maxTasks <= 0 {
+		return
+	}
+	left := c.maxTasks
+	for i := range s.Frameworks {
+		for _, tasks := range []*[]task{&s.Frameworks[i].Tasks, &s.Frameworks[i].Completed} {
+			if len(*tasks) > left {
+				c.truncated.WithLabelValues("task").Add(float64(len(*tasks) - left))
+				*tasks = (*tasks)[:left]
+			}
+			left -= len(*tasks)
+		}
+	}
+}
+
+// dedupSlaves leaves out all but one of the slaves sharing a PID, which
+// happens while slaves re-register. Their metrics would have the same labels,
+// failing the scrape. The active slave is kept, or the last one if several
+// or none are active.
+func (c *masterCollector) dedupSlaves(slaves []slave) []slave {
+	kept := make(map[string]int, len(slaves))
+	for i, s := range slaves {
+		if j, ok := kept[s.PID]; !ok || s.Active || !slaves[j].Active {
+			kept[s.PID] = i
+		}
+	}
+	if len(kept) == len(slaves) {
+		return slaves
+	}
+	unique := make([]slave, 0, len(kept))
+	for i, s := range slaves {
+		if kept[s.PID] != i {
+			log.WithField("slave", s.PID).Warn("Leaving out slave sharing its PID with another slave")
+			c.duplicateSlaves.Inc()
+			continue
+		}
+		unique = append(unique, s)
+	}
+	return unique
+}
+
+// ip returns the IP address of a slave from its PID, such as
+// slave(1)@10.0.0.1:5051 or slave(1)@[::1]:5051.
+func (s slave) ip() string {
+	i := strings.LastIndex(s.PID, "@")
+	if i < 0 {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(s.PID[i+1:])
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// healthy returns the result of the last health check of the task, unless
+// it has no health check or it wasn't checked yet.
+func (t task) healthy() (healthy, ok bool) {
+	if len(t.HealthCheck) == 0 {
+		return false, false
+	}
+	for i := len(t.Statuses) - 1; i >= 0; i-- {
+		if h := t.Statuses[i].Healthy; h != nil {
+			return *h, true
+		}
+	}
+	return false, false
+}
+
+// roundTo returns a function rounding values to the given number of
+// decimals, or leaving them untouched if decimals is negative.
+func roundTo(decimals int) func(float64) float64 {
+	if decimals < 0 {
+		return func(v float64) float64 { return v }
+	}
+	p := math.Pow10(decimals)
+	return func(v float64) float64 {
+		return math.Round(v*p) / p
+	}
+}
+
+// sanitiseLabels makes the fields of a slave used as label values valid
+// UTF-8.
+func (s *slave) sanitiseLabels() {
+	s.PID = sanitiseLabelValue(s.PID)
+	s.Hostname = sanitiseLabelValue(s.Hostname)
+	s.Id = sanitiseLabelValue(s.Id)
+}
+
 func (c *masterCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.tasksScraped.Describe(ch)
+	c.slavesScraped.Describe(ch)
+	c.leadingSeconds.Describe(ch)
+	c.duplicateSlaves.Describe(ch)
+	if c.slavesExcluded != nil {
+		c.slavesExcluded.Describe(ch)
+	}
+	if c.frameworksExcluded != nil {
+		c.frameworksExcluded.Describe(ch)
+	}
+	if c.truncated != nil {
+		c.truncated.Describe(ch)
+	}
 	for metric := range c.metrics {
 		metric.Describe(ch)
 	}
@@ -252,3 +926,54 @@ func (rs ranges) size() uint64 {
 	}
 	return sz
 }
+
+// without returns the ranges of rs not covered by other, in ascending order.
+func (rs ranges) without(other ranges) ranges {
+	other = other.sorted()
+	var left ranges
+	for _, r := range rs.sorted() {
+		lo, hi, covered := r[0], r[1], false
+		for _, o := range other {
+			if o[1] < lo || o[0] > hi {
+				continue
+			}
+			if o[0] > lo {
+				left = append(left, [2]uint64{lo, o[0] - 1})
+			}
+			if o[1] >= hi {
+				covered = true
+				break
+			}
+			lo = o[1] + 1
+		}
+		if !covered {
+			left = append(left, [2]uint64{lo, hi})
+		}
+	}
+	return left
+}
+
+// sorted returns a copy of rs in ascending order.
+func (rs ranges) sorted() ranges {
+	s := append(ranges(nil), rs...)
+	sort.Slice(s, func(i, j int) bool { return s[i][0] < s[j][0] })
+	return s
+}
+
+// bounds returns the lowest and highest value of the ranges, which may be
+// listed in any order. ok is false if there are none.
+func (rs ranges) bounds() (min, max uint64, ok bool) {
+	if len(rs) == 0 {
+		return 0, 0, false
+	}
+	min, max = rs[0][0], rs[0][1]
+	for _, r := range rs[1:] {
+		if r[0] < min {
+			min = r[0]
+		}
+		if r[1] > max {
+			max = r[1]
+		}
+	}
+	return min, max, true
+}
@@ -0,0 +1,723 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSlave_Revocable(t *testing.T) {
+	data := `{
+  "pid": "slave(1)@10.0.0.1:5051",
+  "unreserved_resources": {"cpus": 6, "mem": 3072},
+  "unreserved_resources_full": [
+    {"name": "cpus", "type": "SCALAR", "scalar": {"value": 4}, "role": "*"},
+    {"name": "mem", "type": "SCALAR", "scalar": {"value": 2048}, "role": "*"},
+    {"name": "cpus", "type": "SCALAR", "scalar": {"value": 2}, "role": "*", "revocable": {}},
+    {"name": "mem", "type": "SCALAR", "scalar": {"value": 1024}, "role": "*", "revocable": {}}
+  ]
+}`
+	var s slave
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		t.Fatal(err)
+	}
+	if got := revocableResources(s.UnreservedFull); got.CPUs != 2 || got.Mem != 1024 {
+		t.Errorf("got: %+v, want 2 CPUs and 1024 mem", got)
+	}
+	if got := revocableResources(nil); got.CPUs != 0 || got.Mem != 0 {
+		t.Errorf("got: %+v for no resources, want none", got)
+	}
+}
+
+func TestSlave_Reserved(t *testing.T) {
+	data := `{"reserved_resources": {"web": {"cpus": 2, "mem": 512}, "batch": {"cpus": 0.5}}}`
+	var s slave
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]resources{"web": {CPUs: 2, Mem: 512}, "batch": {CPUs: 0.5}}
+	if !reflect.DeepEqual(s.Reserved, want) {
+		t.Errorf("got: %+v, want: %+v", s.Reserved, want)
+	}
+}
+
+func TestSlave_SanitiseLabels(t *testing.T) {
+	s := slave{PID: "slave(1)@10.0.0.1:5051", Hostname: "agent\xff1", Id: "a1"}
+	s.sanitiseLabels()
+	want := slave{PID: "slave(1)@10.0.0.1:5051", Hostname: "agent\uFFFD1", Id: "a1"}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got: %+v, want: %+v", s, want)
+	}
+}
+
+func TestSlave_IP(t *testing.T) {
+	for pid, want := range map[string]string{
+		"slave(1)@10.0.0.1:5051": "10.0.0.1",
+		"slave(1)@[::1]:5051":    "::1",
+		"slave(1)":               "",
+		"":                       "",
+	} {
+		if got := (slave{PID: pid}).ip(); got != want {
+			t.Errorf("%q: got %q, want %q", pid, got, want)
+		}
+	}
+}
+
+func TestMasterCollector_SlaveJoinLabels(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051", "hostname": "agent1", "port": 5051, "id": "a1", "resources": {"cpus": 4}}]}`,
+	}, masterStateOptions{slaveIPLabel: true, nodeExporterPort: 9100}, collectorOptions{})
+	ch := make(chan prometheus.Metric, 1000)
+	c.Collect(ch)
+	close(ch)
+	for m := range ch {
+		if !strings.Contains(m.Desc().String(), `"mesos_slave_cpus"`) {
+			continue
+		}
+		var pb dto.Metric
+		m.Write(&pb)
+		if got := labelValue(&pb, "ip"); got != "10.0.0.1" {
+			t.Errorf("got ip label %q, want 10.0.0.1", got)
+		}
+		if got := labelValue(&pb, "node_instance"); got != "agent1:9100" {
+			t.Errorf("got node_instance label %q, want agent1:9100", got)
+		}
+		return
+	}
+	t.Fatal("mesos_slave_cpus not found")
+}
+
+func TestRoundTo(t *testing.T) {
+	for _, tt := range []struct {
+		decimals int
+		in, want float64
+	}{
+		{-1, 1.9999999999998, 1.9999999999998},
+		{0, 1.9999999999998, 2},
+		{2, 0.123456, 0.12},
+		{1, 2.25e9, 2.25e9},
+	} {
+		if got := roundTo(tt.decimals)(tt.in); got != tt.want {
+			t.Errorf("roundTo(%d)(%v): got %v, want %v", tt.decimals, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMasterCollector_SlaveTasks(t *testing.T) {
+	st := &state{
+		Slaves: []slave{{PID: "slave(1)@10.0.0.1:5051", Id: "a1"}},
+		Frameworks: []framework{
+			{Tasks: []task{{SlaveID: "a1", State: "TASK_RUNNING"}, {SlaveID: "a1", State: "TASK_RUNNING"}, {SlaveID: "a2", State: "TASK_STAGING"}}},
+			{Tasks: []task{{SlaveID: "a1", State: "TASK_STAGING"}}, Completed: []task{{SlaveID: "a1", State: "TASK_FINISHED"}}},
+		},
+	}
+	c := newMasterStateCollector(fakeFetcher{}, masterStateOptions{}, collectorOptions{}).(*masterCollector)
+
+	want := map[string]float64{
+		"slave(1)@10.0.0.1:5051/TASK_RUNNING": 2,
+		"slave(1)@10.0.0.1:5051/TASK_STAGING": 1,
+		"a2/TASK_STAGING":                     1,
+	}
+	for metric, set := range c.metrics {
+		vec, ok := metric.(*prometheus.GaugeVec)
+		if !ok {
+			continue
+		}
+		ch := make(chan *prometheus.Desc, 1)
+		vec.Describe(ch)
+		if !strings.Contains((<-ch).String(), `"mesos_slave_tasks"`) {
+			continue
+		}
+
+		set(st, metric)
+		got := map[string]float64{}
+		for _, m := range collectMetrics(vec) {
+			got[labelValue(m, "slave")+"/"+labelValue(m, "state")] = m.GetGauge().GetValue()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+		return
+	}
+	t.Fatal("mesos_slave_tasks not found")
+}
+
+func TestMasterCollector_SlaveAllocations(t *testing.T) {
+	data := `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051", "used_resources_full": [
+		{"name": "cpus", "type": "SCALAR", "scalar": {"value": 1.5}, "allocation_info": {"role": "web"}},
+		{"name": "cpus", "type": "SCALAR", "scalar": {"value": 0.5}, "allocation_info": {"role": "web"}},
+		{"name": "mem", "type": "SCALAR", "scalar": {"value": 128}, "allocation_info": {"role": "web"}},
+		{"name": "cpus", "type": "SCALAR", "scalar": {"value": 1}, "role": "batch"}
+	]}]}`
+	var st state
+	if err := json.Unmarshal([]byte(data), &st); err != nil {
+		t.Fatal(err)
+	}
+	c := newMasterStateCollector(fakeFetcher{}, masterStateOptions{slaveAllocations: true}, collectorOptions{}).(*masterCollector)
+
+	want := map[string]float64{"web": 2, "batch": 1}
+	for metric, set := range c.metrics {
+		vec, ok := metric.(*prometheus.GaugeVec)
+		if !ok {
+			continue
+		}
+		ch := make(chan *prometheus.Desc, 1)
+		vec.Describe(ch)
+		if !strings.Contains((<-ch).String(), `"mesos_slave_allocated_cpus"`) {
+			continue
+		}
+
+		set(&st, metric)
+		got := map[string]float64{}
+		for _, m := range collectMetrics(vec) {
+			got[labelValue(m, "role")] = m.GetGauge().GetValue()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+		return
+	}
+	t.Fatal("mesos_slave_allocated_cpus not found")
+}
+
+func collectMetrics(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+	var ms []*dto.Metric
+	for m := range ch {
+		var pb dto.Metric
+		m.Write(&pb)
+		ms = append(ms, &pb)
+	}
+	return ms
+}
+
+// gatherByName collects c and returns the values of the metrics named. A
+// name may end with a label in braces, such as mesos_task_cpus{task_id}, to
+// key every series by the value of that label, as in mesos_task_cpus{t1},
+// rather than by the name alone.
+func gatherByName(c prometheus.Collector, names ...string) map[string]float64 {
+	ch := make(chan prometheus.Metric, 1000)
+	c.Collect(ch)
+	close(ch)
+	got := map[string]float64{}
+	for m := range ch {
+		desc := m.Desc().String()
+		for _, name := range names {
+			label := ""
+			if i := strings.Index(name, "{"); i >= 0 {
+				name, label = name[:i], strings.Trim(name[i:], "{}")
+			}
+			if !strings.Contains(desc, `"`+name+`"`) {
+				continue
+			}
+			var pb dto.Metric
+			m.Write(&pb)
+			value := pb.GetGauge().GetValue()
+			if pb.Counter != nil {
+				value = pb.GetCounter().GetValue()
+			}
+			if label != "" {
+				name += "{" + labelValue(&pb, label) + "}"
+			}
+			got[name] = value
+		}
+	}
+	return got
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestMasterCollector_OnlyActiveSlaves(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{"pid": "s1", "active": true}, {"pid": "s2", "active": false}]}`,
+	}, masterStateOptions{onlyActiveSlaves: true}, collectorOptions{}).(*masterCollector)
+
+	ch := make(chan prometheus.Metric, 1000)
+	c.Collect(ch)
+	close(ch)
+	for m := range ch {
+		var pb dto.Metric
+		m.Write(&pb)
+		if slave := labelValue(&pb, "slave"); slave != "" && slave != "s1" {
+			t.Errorf("got a metric for inactive slave %s: %s", slave, m.Desc())
+		}
+	}
+	if got := collectMetrics(c.slavesExcluded)[0].GetGauge().GetValue(); got != 1 {
+		t.Errorf("got %v excluded slaves, want 1", got)
+	}
+}
+
+func TestMasterCollector_SlaveTurnsInactive(t *testing.T) {
+	fetcher := fakeFetcher{
+		"/state": `{"slaves": [{"pid": "s1", "active": true, "resources": {"cpus": 4}}, {"pid": "s2", "active": true, "resources": {"cpus": 4}}]}`,
+	}
+	c := newMasterStateCollector(fetcher, masterStateOptions{onlyActiveSlaves: true}, collectorOptions{})
+	slaves := func() map[string]bool {
+		ch := make(chan prometheus.Metric, 1000)
+		c.Collect(ch)
+		close(ch)
+		got := map[string]bool{}
+		for m := range ch {
+			var pb dto.Metric
+			m.Write(&pb)
+			if slave := labelValue(&pb, "slave"); slave != "" {
+				got[slave] = true
+			}
+		}
+		return got
+	}
+
+	if got, want := slaves(), map[string]bool{"s1": true, "s2": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got slaves %v, want %v", got, want)
+	}
+	fetcher["/state"] = `{"slaves": [{"pid": "s1", "active": true, "resources": {"cpus": 4}}, {"pid": "s2", "active": false, "resources": {"cpus": 4}}]}`
+	if got, want := slaves(), map[string]bool{"s1": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got slaves %v once s2 turned inactive, want %v", got, want)
+	}
+}
+
+func TestMasterCollector_OnlyActiveFrameworks(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [
+  {"id": "f1", "active": true, "tasks": [{"id": "t1", "framework_id": "f1", "state": "TASK_RUNNING"}]},
+  {"id": "f2", "active": false, "tasks": [{"id": "t2", "framework_id": "f2", "state": "TASK_RUNNING"}]}
+]}`,
+	}, masterStateOptions{onlyActiveFrameworks: true, frameworkInfo: true}, collectorOptions{}).(*masterCollector)
+
+	ch := make(chan prometheus.Metric, 1000)
+	c.Collect(ch)
+	close(ch)
+	for m := range ch {
+		var pb dto.Metric
+		m.Write(&pb)
+		if id := labelValue(&pb, "framework_id"); id != "" && id != "f1" {
+			t.Errorf("got a metric for inactive framework %s: %s", id, m.Desc())
+		}
+	}
+	if got := collectMetrics(c.frameworksExcluded)[0].GetGauge().GetValue(); got != 1 {
+		t.Errorf("got %v excluded frameworks, want 1", got)
+	}
+}
+
+func TestMasterCollector_AnnotatedResources(t *testing.T) {
+	// This payload is made up, none was captured from a master with such
+	// agents. The totals of a slave come from the keys named after the
+	// resource alone, as Mesos sums them over all roles. A key naming the
+	// role as well, such as cpus(web), is a share of that total, so it is
+	// left out rather than counting the reservation twice.
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{
+  "pid": "slave(1)@10.0.0.1:5051",
+  "resources": {
+    "cpus": {"value": 8, "role": "*"},
+    "cpus(web)": {"value": 2, "role": "web", "reservation": {"principal": "ops"}},
+    "mem": 15360,
+    "disk": {"value": 40000},
+    "ports": "[31000-32000]"
+  },
+  "used_resources": {"cpus": 1.5, "mem": 512, "disk": 0}
+}]}`,
+	}, masterStateOptions{roundResources: -1}, collectorOptions{})
+	got := gatherByName(c, "mesos_slave_cpus", "mesos_slave_cpus_used", "mesos_slave_mem_bytes", "mesos_slave_disk_bytes")
+	want := map[string]float64{
+		"mesos_slave_cpus":       8,
+		"mesos_slave_cpus_used":  1.5,
+		"mesos_slave_mem_bytes":  15360 << 20,
+		"mesos_slave_disk_bytes": 40000 << 20,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_DeprecatedUsed(t *testing.T) {
+	// The *_used names are kept, with the same values, until dashboards
+	// moved to the *_allocated ones.
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051", "used_resources": {"cpus": 1.5, "mem": 2, "disk": 3}}]}`,
+	}, masterStateOptions{roundResources: -1}, collectorOptions{})
+	got := gatherByName(c,
+		"mesos_slave_cpus_allocated", "mesos_slave_mem_allocated_bytes", "mesos_slave_disk_allocated_bytes",
+		"mesos_slave_cpus_used", "mesos_slave_mem_used_bytes", "mesos_slave_disk_used_bytes")
+	want := map[string]float64{
+		"mesos_slave_cpus_allocated":       1.5,
+		"mesos_slave_mem_allocated_bytes":  2 << 20,
+		"mesos_slave_disk_allocated_bytes": 3 << 20,
+		"mesos_slave_cpus_used":            1.5,
+		"mesos_slave_mem_used_bytes":       2 << 20,
+		"mesos_slave_disk_used_bytes":      3 << 20,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_PortRanges(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [
+  {"pid": "s1", "hostname": "agent1", "resources": {"ports": "[31000-31500, 31600-32000]"}},
+  {"pid": "s2", "hostname": "agent2", "resources": {"cpus": 1}}
+]}`,
+	}, masterStateOptions{slavePortRanges: true, nodeExporterPort: 9100}, collectorOptions{})
+	got := gatherByName(c, "mesos_slave_ports_range_min{node_instance}", "mesos_slave_ports_range_max{node_instance}")
+	want := map[string]float64{
+		"mesos_slave_ports_range_min{agent1:9100}": 31000,
+		"mesos_slave_ports_range_max{agent1:9100}": 32000,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_PortsFragments(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{"pid": "s1", "resources": {"ports": "[31000-32000]"}, "used_resources": {"ports": "[31100-31100, 31200-31300]"}}]}`,
+	}, masterStateOptions{}, collectorOptions{})
+	got, ok := gatherByName(c, "mesos_slave_ports_fragments")["mesos_slave_ports_fragments"]
+	if !ok {
+		t.Fatal("mesos_slave_ports_fragments not found")
+	}
+	if got != 3 {
+		t.Errorf("got %v fragments, want 3", got)
+	}
+}
+
+func TestMasterCollector_SlaveAllocationsAddUp(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051", "used_resources_full": [
+  {"name": "cpus", "type": "SCALAR", "scalar": {"value": 1.5}, "allocation_info": {"role": "web"}},
+  {"name": "mem", "type": "SCALAR", "scalar": {"value": 2}, "allocation_info": {"role": "web"}},
+  {"name": "disk", "type": "SCALAR", "scalar": {"value": 3}, "allocation_info": {"role": "batch"}}
+]}]}`,
+	}, masterStateOptions{slaveAllocations: true, roundResources: -1}, collectorOptions{})
+	got := gatherByName(c, "mesos_slave_allocated_cpus{role}", "mesos_slave_allocated_mem_bytes{role}", "mesos_slave_allocated_disk_bytes{role}")
+	want := map[string]float64{
+		"mesos_slave_allocated_cpus{web}":         1.5,
+		"mesos_slave_allocated_cpus{batch}":       0,
+		"mesos_slave_allocated_mem_bytes{web}":    2 << 20,
+		"mesos_slave_allocated_mem_bytes{batch}":  0,
+		"mesos_slave_allocated_disk_bytes{web}":   0,
+		"mesos_slave_allocated_disk_bytes{batch}": 3 << 20,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_MemoryUnit(t *testing.T) {
+	for unit, want := range map[string]map[string]float64{
+		"bytes": {"mesos_slave_mem_bytes": 2 << 20, "mesos_slave_disk_bytes": 3 << 20},
+		"mib":   {"mesos_slave_mem_mebibytes": 2, "mesos_slave_disk_mebibytes": 3},
+	} {
+		c := newMasterStateCollector(fakeFetcher{
+			"/state": `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051", "resources": {"mem": 2, "disk": 3}}]}`,
+		}, masterStateOptions{roundResources: -1}, collectorOptions{memUnit: memoryUnits[unit]})
+		var names []string
+		for name := range want {
+			names = append(names, name)
+		}
+		got := gatherByName(c, names...)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got: %v, want: %v", unit, got, want)
+		}
+	}
+}
+
+func TestMasterCollector_SlaveReservations(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051", "hostname": "agent1", "port": 5051, "id": "a1",
+  "reserved_resources": {"web/api": {"cpus": 1.5}}}]}`,
+	}, masterStateOptions{slaveReservations: true, slaveIPLabel: true, nodeExporterPort: 9100, roundResources: -1}, collectorOptions{parentRoleLabel: true})
+	got := gatherByName(c, "mesos_slave_reserved_cpus{node_instance}", "mesos_slave_reserved_cpus{parent_role}")
+	want := map[string]float64{"mesos_slave_reserved_cpus{agent1:9100}": 1.5, "mesos_slave_reserved_cpus{web}": 1.5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_ClusterReservations(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [
+  {"pid": "s1", "reserved_resources": {"web": {"cpus": 1.5}, "batch": {"cpus": 1}}},
+  {"pid": "s2", "reserved_resources": {"web": {"cpus": 2}}}
+]}`,
+	}, masterStateOptions{clusterReservations: true, roundResources: -1}, collectorOptions{})
+	got := gatherByName(c, "mesos_cluster_reserved_cpus{role}")
+	want := map[string]float64{"mesos_cluster_reserved_cpus{web}": 3.5, "mesos_cluster_reserved_cpus{batch}": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_TaskHealth(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [{"id": "f1", "tasks": [
+  {"id": "healthy", "framework_id": "f1", "health_check": {"type": "HTTP"},
+   "statuses": [{"state": "TASK_RUNNING", "healthy": false}, {"state": "TASK_RUNNING", "healthy": true}]},
+  {"id": "unhealthy", "framework_id": "f1", "health_check": {"type": "HTTP"},
+   "statuses": [{"state": "TASK_RUNNING", "healthy": false}]},
+  {"id": "unchecked", "framework_id": "f1", "health_check": {"type": "HTTP"},
+   "statuses": [{"state": "TASK_RUNNING"}]},
+  {"id": "nocheck", "framework_id": "f1", "statuses": [{"state": "TASK_RUNNING"}]}
+]}]}`,
+	}, masterStateOptions{taskHealth: true}, collectorOptions{})
+	got := gatherByName(c, "mesos_task_healthy{task_id}")
+	want := map[string]float64{"mesos_task_healthy{healthy}": 1, "mesos_task_healthy{unhealthy}": 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_TaskResources(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [{"id": "f1",
+  "executors": [
+    {"executor_id": "e1", "slave_id": "s1", "resources": {"cpus": 0.1, "mem": 32}},
+    {"executor_id": "e1", "slave_id": "s2", "resources": {"cpus": 0.2, "mem": 64}}
+  ],
+  "tasks": [
+    {"id": "custom", "framework_id": "f1", "executor_id": "e1", "slave_id": "s2", "resources": {"cpus": 1, "mem": 128}},
+    {"id": "command", "framework_id": "f1", "slave_id": "s1", "resources": {"cpus": 0.5, "mem": 256}}
+  ]}]}`,
+	}, masterStateOptions{taskResources: true, roundResources: -1}, collectorOptions{})
+	got := gatherByName(c, "mesos_task_cpus{task_id}", "mesos_task_mem_bytes{task_id}", "mesos_task_executor_cpus{task_id}", "mesos_task_executor_mem_bytes{task_id}")
+	want := map[string]float64{
+		"mesos_task_cpus{custom}":               1,
+		"mesos_task_mem_bytes{custom}":          128 << 20,
+		"mesos_task_executor_cpus{custom}":      0.2,
+		"mesos_task_executor_mem_bytes{custom}": 64 << 20,
+		"mesos_task_cpus{command}":              0.5,
+		"mesos_task_mem_bytes{command}":         256 << 20,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_GPUs(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [
+  {"pid": "gpu", "resources": {"cpus": 8, "gpus": 4}, "used_resources": {"gpus": 3}, "unreserved_resources": {"gpus": 2}},
+  {"pid": "cpu", "resources": {"cpus": 8}}
+]}`,
+	}, masterStateOptions{roundResources: -1}, collectorOptions{})
+	got := gatherByName(c, "mesos_slave_gpus{slave}", "mesos_slave_gpus_used{slave}", "mesos_slave_gpus_unreserved{slave}")
+	want := map[string]float64{
+		"mesos_slave_gpus{gpu}":            4,
+		"mesos_slave_gpus_used{gpu}":       3,
+		"mesos_slave_gpus_unreserved{gpu}": 2,
+		"mesos_slave_gpus{cpu}":            0,
+		"mesos_slave_gpus_used{cpu}":       0,
+		"mesos_slave_gpus_unreserved{cpu}": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_SlaveResources(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051", "resources_full": [
+  {"name": "cpus", "type": "SCALAR", "scalar": {"value": 4}},
+  {"name": "licenses", "type": "SCALAR", "scalar": {"value": 2}},
+  {"name": "licenses", "type": "SCALAR", "scalar": {"value": 1}, "reservations": [{"role": "web"}]},
+  {"name": "ports", "type": "RANGES", "ranges": {"range": [{"begin": 31000, "end": 32000}]}}
+]}]}`,
+	}, masterStateOptions{slaveResources: true, slaveIPLabel: true, roundResources: -1}, collectorOptions{})
+	got := gatherByName(c, "mesos_slave_resource{name}")
+	want := map[string]float64{"mesos_slave_resource{cpus}": 4, "mesos_slave_resource{licenses}": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if got := gatherByName(c, "mesos_slave_resource{ip}"); len(got) != 1 {
+		t.Errorf("got ip labels %v, want 10.0.0.1 only", got)
+	} else if _, ok := got["mesos_slave_resource{10.0.0.1}"]; !ok {
+		t.Errorf("got ip labels %v, want 10.0.0.1 only", got)
+	}
+}
+
+func TestMasterCollector_CompletedTasksRetained(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [
+  {"id": "f1", "completed_tasks": [{"id": "t1"}, {"id": "t2"}]},
+  {"id": "f2", "tasks": [{"id": "t3"}]}
+]}`,
+	}, masterStateOptions{frameworkInfo: true}, collectorOptions{})
+	got := gatherByName(c, "mesos_framework_completed_tasks_retained{framework_id}")
+	want := map[string]float64{
+		"mesos_framework_completed_tasks_retained{f1}": 2,
+		"mesos_framework_completed_tasks_retained{f2}": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_LeadingSeconds(t *testing.T) {
+	elected := float64(time.Now().Add(-time.Hour).UnixNano()) / 1e9
+	for _, tt := range []struct {
+		data string
+		want []float64
+	}{
+		{fmt.Sprintf(`{"start_time": %f, "elected_time": %f}`, elected-60, elected), []float64{3600}},
+		{`{"start_time": 1556822310.5}`, nil},
+	} {
+		c := newMasterStateCollector(fakeFetcher{"/state": tt.data}, masterStateOptions{}, collectorOptions{})
+		var got []float64
+		if leading, ok := gatherByName(c, "mesos_master_leading_seconds")["mesos_master_leading_seconds"]; ok {
+			got = append(got, math.Round(leading))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got: %v, want: %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestMasterCollector_DuplicateSlaves(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"slaves": [
+  {"pid": "slave(1)@10.0.0.1:5051", "id": "old", "active": true, "resources": {"cpus": 2}},
+  {"pid": "slave(1)@10.0.0.2:5051", "id": "other", "active": true, "resources": {"cpus": 4}},
+  {"pid": "slave(1)@10.0.0.1:5051", "id": "new", "active": true, "resources": {"cpus": 8}},
+  {"pid": "slave(1)@10.0.0.3:5051", "id": "active", "active": true, "resources": {"cpus": 2}},
+  {"pid": "slave(1)@10.0.0.3:5051", "id": "inactive", "active": false, "resources": {"cpus": 4}}
+]}`,
+	}, masterStateOptions{slaveAttributeLabels: []string{"rack"}}, collectorOptions{}).(*masterCollector)
+
+	// Registering checks for duplicate series on gathering.
+	r := prometheus.NewRegistry()
+	r.MustRegister(c)
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, mf := range mfs {
+		if mf.GetName() == "mesos_slave_cpus" {
+			for _, m := range mf.Metric {
+				got[labelValue(m, "slave")] = labelValue(m, "id")
+			}
+		}
+	}
+	// The active slave is kept over a later inactive one.
+	want := map[string]string{
+		"slave(1)@10.0.0.1:5051": "new",
+		"slave(1)@10.0.0.2:5051": "other",
+		"slave(1)@10.0.0.3:5051": "active",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if got := collectMetrics(c.duplicateSlaves)[0].GetCounter().GetValue(); got != 2 {
+		t.Errorf("got %v duplicate slaves, want 2", got)
+	}
+}
+
+func TestMasterCollector_FrameworkInfo(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [{"id": "f1", "name": "marathon", "webui_url": "http://marathon.example.org:8080"}]}`,
+	}, masterStateOptions{frameworkInfo: true}, collectorOptions{})
+	ch := make(chan prometheus.Metric, 1000)
+	c.Collect(ch)
+	close(ch)
+	for m := range ch {
+		if !strings.Contains(m.Desc().String(), `"mesos_framework_info"`) {
+			continue
+		}
+		var pb dto.Metric
+		m.Write(&pb)
+		for name, want := range map[string]string{
+			"framework_id": "f1",
+			"name":         "marathon",
+			"webui_url":    "http://marathon.example.org:8080",
+		} {
+			if got := labelValue(&pb, name); got != want {
+				t.Errorf("got %s label %q, want %q", name, got, want)
+			}
+		}
+		return
+	}
+	t.Fatal("mesos_framework_info not found")
+}
+
+func TestMasterCollector_FrameworkWithoutTasks(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [{"id": "f1", "name": "idle", "tasks": null}, {"id": "f2", "name": "new"}]}`,
+	}, masterStateOptions{frameworkInfo: true}, collectorOptions{})
+	got := gatherByName(c, "mesos_exporter_tasks_scraped", "mesos_framework_info{framework_id}")
+	want := map[string]float64{
+		"mesos_exporter_tasks_scraped": 0,
+		"mesos_framework_info{f1}":     1,
+		"mesos_framework_info{f2}":     1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_Truncate(t *testing.T) {
+	c := newMasterStateCollector(nil, masterStateOptions{maxFrameworks: 2, maxTasks: 3}, collectorOptions{}).(*masterCollector)
+	s := state{Frameworks: []framework{
+		{ID: "f1", Tasks: []task{{ID: "t1"}, {ID: "t2"}}, Completed: []task{{ID: "t3"}, {ID: "t4"}}},
+		{ID: "f2", Tasks: []task{{ID: "t5"}}},
+		{ID: "f3", Tasks: []task{{ID: "t6"}}},
+	}}
+	c.truncate(&s)
+
+	want := []framework{
+		{ID: "f1", Tasks: []task{{ID: "t1"}, {ID: "t2"}}, Completed: []task{{ID: "t3"}}},
+		{ID: "f2", Tasks: []task{}},
+	}
+	if !reflect.DeepEqual(s.Frameworks, want) {
+		t.Errorf("got: %+v, want: %+v", s.Frameworks, want)
+	}
+	for typ, want := range map[string]float64{"framework": 1, "task": 2} {
+		var pb dto.Metric
+		c.truncated.WithLabelValues(typ).Write(&pb)
+		if got := pb.GetCounter().GetValue(); got != want {
+			t.Errorf("got %v truncated %s, want %v", got, typ, want)
+		}
+	}
+}
+
+func TestMasterCollector_FrameworkReregistered(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [{"id": "f1", "reregistered_time": 1500000000.5}, {"id": "f2"}]}`,
+	}, masterStateOptions{frameworkInfo: true}, collectorOptions{})
+	got := gatherByName(c, "mesos_framework_reregistered_time_seconds{framework_id}")
+	if want := map[string]float64{"mesos_framework_reregistered_time_seconds{f1}": 1500000000.5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMasterCollector_FrameworkResources(t *testing.T) {
+	c := newMasterStateCollector(fakeFetcher{
+		"/state": `{"frameworks": [{"id": "f1", "used_resources": {"cpus": 2, "mem": 128}, "offered_resources": {"cpus": 6, "mem": 512}}]}`,
+	}, masterStateOptions{frameworkInfo: true, roundResources: -1}, collectorOptions{})
+	got := gatherByName(c, "mesos_framework_used_cpus", "mesos_framework_offered_cpus", "mesos_framework_used_mem_bytes", "mesos_framework_offered_mem_bytes")
+	want := map[string]float64{
+		"mesos_framework_used_cpus":         2,
+		"mesos_framework_offered_cpus":      6,
+		"mesos_framework_used_mem_bytes":    128 << 20,
+		"mesos_framework_offered_mem_bytes": 512 << 20,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
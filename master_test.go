@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMasterCollector_Registrar(t *testing.T) {
+	for _, tt := range []struct {
+		snapshot string
+		want     map[string]float64
+	}{
+		{
+			`{"registrar/queued_operations": 3, "registrar/log/recovered": 1, "registrar/log/ensemble_size": 5}`,
+			map[string]float64{"mesos_registrar_queued_operations": 3, "mesos_registrar_log_recovered": 1, "mesos_registrar_log_ensemble_size": 5},
+		},
+		{
+			`{"registrar/queued_operations": 0}`,
+			map[string]float64{"mesos_registrar_queued_operations": 0},
+		},
+	} {
+		c := newMasterCollector(fakeFetcher{"/metrics/snapshot": tt.snapshot}, collectorOptions{})
+		got := gatherByName(c, "mesos_registrar_queued_operations", "mesos_registrar_log_recovered", "mesos_registrar_log_ensemble_size")
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got: %v, want: %v", tt.snapshot, got, tt.want)
+		}
+	}
+}
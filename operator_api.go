@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// v1Calls maps the v0 endpoints to the v1 operator API calls replacing
+// them. Endpoints missing here have no v1 equivalent and are always
+// fetched from the v0 API.
+var v1Calls = map[string]string{
+	"/state":            "GET_STATE",
+	"/metrics/snapshot": "GET_METRICS",
+	"/version":          "GET_VERSION",
+}
+
+type (
+	v1ID struct {
+		Value string `json:"value"`
+	}
+
+	// resourceInfo is a single Resource message in its JSON form, as used
+	// by the v1 operator API.
+	resourceInfo struct {
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Role   string `json:"role"`
+		Scalar struct {
+			Value float64 `json:"value"`
+		} `json:"scalar"`
+		Ranges struct {
+			Range []struct {
+				Begin uint64 `json:"begin"`
+				End   uint64 `json:"end"`
+			} `json:"range"`
+		} `json:"ranges"`
+		Reservations []struct {
+			Role string `json:"role"`
+		} `json:"reservations"`
+		// Revocable is set for resources offered through oversubscription
+		Revocable      *struct{} `json:"revocable"`
+		AllocationInfo struct {
+			Role string `json:"role"`
+		} `json:"allocation_info"`
+	}
+
+	v1Attribute struct {
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Scalar struct {
+			Value float64 `json:"value"`
+		} `json:"scalar"`
+		Text struct {
+			Value string `json:"value"`
+		} `json:"text"`
+	}
+
+	v1Task struct {
+		Name        string         `json:"name"`
+		TaskID      v1ID           `json:"task_id"`
+		FrameworkID v1ID           `json:"framework_id"`
+		ExecutorID  v1ID           `json:"executor_id"`
+		AgentID     v1ID           `json:"agent_id"`
+		State       string         `json:"state"`
+		Resources   []resourceInfo `json:"resources"`
+		Labels      struct {
+			Labels []label `json:"labels"`
+		} `json:"labels"`
+		Statuses []status `json:"statuses"`
+	}
+
+	v1Framework struct {
+		FrameworkInfo struct {
+			ID       v1ID   `json:"id"`
+			Name     string `json:"name"`
+			WebUIURL string `json:"webui_url"`
+		} `json:"framework_info"`
+		Active             bool           `json:"active"`
+		ReregisteredTime   *v1TimeInfo    `json:"reregistered_time"`
+		AllocatedResources []resourceInfo `json:"allocated_resources"`
+		OfferedResources   []resourceInfo `json:"offered_resources"`
+	}
+
+	v1Executor struct {
+		ExecutorInfo struct {
+			ExecutorID  v1ID           `json:"executor_id"`
+			FrameworkID v1ID           `json:"framework_id"`
+			Resources   []resourceInfo `json:"resources"`
+		} `json:"executor_info"`
+		AgentID v1ID `json:"agent_id"`
+	}
+
+	v1TimeInfo struct {
+		Nanoseconds int64 `json:"nanoseconds"`
+	}
+
+	v1Agent struct {
+		AgentInfo struct {
+			Hostname   string        `json:"hostname"`
+			Port       uint32        `json:"port"`
+			ID         v1ID          `json:"id"`
+			Attributes []v1Attribute `json:"attributes"`
+		} `json:"agent_info"`
+		PID                string         `json:"pid"`
+		Active             bool           `json:"active"`
+		RegisteredTime     v1TimeInfo     `json:"registered_time"`
+		ReregisteredTime   *v1TimeInfo    `json:"reregistered_time"`
+		TotalResources     []resourceInfo `json:"total_resources"`
+		AllocatedResources []resourceInfo `json:"allocated_resources"`
+	}
+
+	v1Response struct {
+		Type     string `json:"type"`
+		GetState *struct {
+			GetTasks struct {
+				Tasks          []v1Task `json:"tasks"`
+				CompletedTasks []v1Task `json:"completed_tasks"`
+			} `json:"get_tasks"`
+			GetFrameworks struct {
+				Frameworks          []v1Framework `json:"frameworks"`
+				CompletedFrameworks []v1Framework `json:"completed_frameworks"`
+			} `json:"get_frameworks"`
+			GetExecutors struct {
+				Executors []v1Executor `json:"executors"`
+			} `json:"get_executors"`
+			GetAgents struct {
+				Agents []v1Agent `json:"agents"`
+			} `json:"get_agents"`
+		} `json:"get_state"`
+		GetMetrics *struct {
+			Metrics []struct {
+				Name  string  `json:"name"`
+				Value float64 `json:"value"`
+			} `json:"metrics"`
+		} `json:"get_metrics"`
+		GetVersion *struct {
+			VersionInfo versionFields `json:"version_info"`
+		} `json:"get_version"`
+	}
+)
+
+// convert fills target, one of the v0 response types, from the v1 response.
+func (r *v1Response) convert(target interface{}) error {
+	switch t := target.(type) {
+	case *state:
+		if r.GetState == nil {
+			return fmt.Errorf("%s response lacks get_state", r.Type)
+		}
+		*t = r.state()
+	case *metricMap:
+		if r.GetMetrics == nil {
+			return fmt.Errorf("%s response lacks get_metrics", r.Type)
+		}
+		m := metricMap{}
+		for _, metric := range r.GetMetrics.Metrics {
+			m[metric.Name] = metric.Value
+		}
+		*t = m
+	case *versionFields:
+		if r.GetVersion == nil {
+			return fmt.Errorf("%s response lacks get_version", r.Type)
+		}
+		*t = r.GetVersion.VersionInfo
+	default:
+		return fmt.Errorf("no v1 conversion for %T", target)
+	}
+	return nil
+}
+
+func (r *v1Response) state() state {
+	st := r.GetState
+	frameworks := map[string]*framework{}
+	var ids []string
+	for _, fws := range [][]v1Framework{st.GetFrameworks.Frameworks, st.GetFrameworks.CompletedFrameworks} {
+		for _, fw := range fws {
+			// The allocated resources of a framework are the used
+			// resources of the v0 API.
+			f := &framework{
+				ID:       fw.FrameworkInfo.ID.Value,
+				Name:     fw.FrameworkInfo.Name,
+				WebUIURL: fw.FrameworkInfo.WebUIURL,
+				Active:   fw.Active,
+				Used:     sumResources(fw.AllocatedResources, false),
+				Offered:  sumResources(fw.OfferedResources, false),
+			}
+			if fw.ReregisteredTime != nil {
+				f.ReregisteredTime = fw.ReregisteredTime.seconds()
+			}
+			frameworks[fw.FrameworkInfo.ID.Value] = f
+			ids = append(ids, fw.FrameworkInfo.ID.Value)
+		}
+	}
+	frameworkOf := func(id string) *framework {
+		fw, ok := frameworks[id]
+		if !ok {
+			fw = &framework{ID: id}
+			frameworks[id] = fw
+			ids = append(ids, id)
+		}
+		return fw
+	}
+	for _, t := range st.GetTasks.Tasks {
+		fw := frameworkOf(t.FrameworkID.Value)
+		fw.Tasks = append(fw.Tasks, t.task())
+	}
+	for _, t := range st.GetTasks.CompletedTasks {
+		fw := frameworkOf(t.FrameworkID.Value)
+		fw.Completed = append(fw.Completed, t.task())
+	}
+	for _, e := range st.GetExecutors.Executors {
+		fw := frameworkOf(e.ExecutorInfo.FrameworkID.Value)
+		fw.Executors = append(fw.Executors, frameworkExecutor{
+			ID:        e.ExecutorInfo.ExecutorID.Value,
+			SlaveID:   e.AgentID.Value,
+			Resources: sumResources(e.ExecutorInfo.Resources, false),
+		})
+	}
+
+	var s state
+	for _, id := range ids {
+		s.Frameworks = append(s.Frameworks, *frameworks[id])
+	}
+	for _, a := range st.GetAgents.Agents {
+		s.Slaves = append(s.Slaves, a.slave())
+	}
+	return s
+}
+
+func (t v1Task) task() task {
+	tk := task{
+		Name:        t.Name,
+		ID:          t.TaskID.Value,
+		ExecutorID:  t.ExecutorID.Value,
+		FrameworkID: t.FrameworkID.Value,
+		SlaveID:     t.AgentID.Value,
+		State:       t.State,
+		Labels:      t.Labels.Labels,
+		Resources:   sumResources(t.Resources, false),
+		Statuses:    t.Statuses,
+	}
+	for _, r := range t.Resources {
+		if r.AllocationInfo.Role != "" {
+			tk.Role = r.AllocationInfo.Role
+			break
+		}
+	}
+	return tk
+}
+
+func (a v1Agent) slave() slave {
+	attrs := map[string]json.RawMessage{}
+	for _, attr := range a.AgentInfo.Attributes {
+		switch attr.Type {
+		case "SCALAR":
+			attrs[attr.Name] = json.RawMessage(strconv.FormatFloat(attr.Scalar.Value, 'f', -1, 64))
+		case "TEXT":
+			value, _ := json.Marshal(attr.Text.Value)
+			attrs[attr.Name] = json.RawMessage(value)
+		}
+	}
+	var unreserved []resourceInfo
+	byRole := map[string][]resourceInfo{}
+	for _, r := range a.TotalResources {
+		if r.reserved() {
+			byRole[r.reservationRole()] = append(byRole[r.reservationRole()], r)
+		} else {
+			unreserved = append(unreserved, r)
+		}
+	}
+	reserved := map[string]resources{}
+	for role, rs := range byRole {
+		reserved[role] = sumResources(rs, false)
+	}
+	var reregistered float64
+	if a.ReregisteredTime != nil {
+		reregistered = a.ReregisteredTime.seconds()
+	}
+	return slave{
+		PID:              a.PID,
+		Hostname:         a.AgentInfo.Hostname,
+		Id:               a.AgentInfo.ID.Value,
+		Port:             a.AgentInfo.Port,
+		Active:           a.Active,
+		RegisteredTime:   a.RegisteredTime.seconds(),
+		ReregisteredTime: reregistered,
+		Used:             sumResources(a.AllocatedResources, false),
+		Unreserved:       sumResources(a.TotalResources, true),
+		Total:            sumResources(a.TotalResources, false),
+		Reserved:         reserved,
+		Attributes:       attrs,
+		UnreservedFull:   unreserved,
+		UsedFull:         a.AllocatedResources,
+		TotalFull:        a.TotalResources,
+	}
+}
+
+func (r resourceInfo) reserved() bool {
+	return len(r.Reservations) > 0 || (r.Role != "" && r.Role != "*")
+}
+
+// reservationRole returns the role a reserved resource is reserved for,
+// which is the last one of hierarchical reservations.
+func (r resourceInfo) reservationRole() string {
+	if n := len(r.Reservations); n > 0 {
+		return r.Reservations[n-1].Role
+	}
+	return r.Role
+}
+
+func (t v1TimeInfo) seconds() float64 {
+	return float64(t.Nanoseconds) / 1e9
+}
+
+// allocationRole returns the role a used resource is allocated to. Masters
+// before multi-role support only give the role of the resource.
+func (r resourceInfo) allocationRole() string {
+	if r.AllocationInfo.Role != "" {
+		return r.AllocationInfo.Role
+	}
+	if r.Role != "" {
+		return r.Role
+	}
+	return "*"
+}
+
+// sumResources adds up a list of Resource messages into the v0 resources
+// representation, optionally skipping reserved resources.
+func sumResources(rs []resourceInfo, unreservedOnly bool) resources {
+	var sum resources
+	for _, r := range rs {
+		if unreservedOnly && r.reserved() {
+			continue
+		}
+		switch r.Name {
+		case "cpus":
+			sum.CPUs += r.Scalar.Value
+		case "mem":
+			sum.Mem += r.Scalar.Value
+		case "disk":
+			sum.Disk += r.Scalar.Value
+		case "gpus":
+			sum.GPUs += r.Scalar.Value
+		case "ports":
+			for _, rng := range r.Ranges.Range {
+				sum.Ports = append(sum.Ports, [2]uint64{rng.Begin, rng.End})
+			}
+		}
+	}
+	return sum
+}
+
+// revocableResources adds up the revocable resources of a list.
+func revocableResources(rs []resourceInfo) resources {
+	var revocable []resourceInfo
+	for _, r := range rs {
+		if r.Revocable != nil {
+			revocable = append(revocable, r)
+		}
+	}
+	return sumResources(revocable, false)
+}
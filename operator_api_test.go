@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestV1Response_ConvertState(t *testing.T) {
+	data := `{
+  "type": "GET_STATE",
+  "get_state": {
+    "get_tasks": {
+      "tasks": [{"name": "web", "task_id": {"value": "web.1"}, "framework_id": {"value": "fw1"},
+                 "executor_id": {"value": "web"}, "agent_id": {"value": "a1"}, "state": "TASK_RUNNING",
+                 "resources": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 0.5}, "allocation_info": {"role": "web"}}]}],
+      "completed_tasks": [{"name": "batch", "task_id": {"value": "batch.1"}, "framework_id": {"value": "fw2"}, "state": "TASK_FINISHED"}]
+    },
+    "get_executors": {"executors": [{"agent_id": {"value": "a1"}, "executor_info": {
+      "executor_id": {"value": "web"}, "framework_id": {"value": "fw1"},
+      "resources": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 0.1}}, {"name": "mem", "type": "SCALAR", "scalar": {"value": 32}}]
+    }}, {"agent_id": {"value": "a1"}, "executor_info": {"executor_id": {"value": "batch"}, "framework_id": {"value": "fw3"}}}]},
+    "get_frameworks": {
+      "frameworks": [{"framework_info": {"id": {"value": "fw0"}}, "active": true},
+                     {"framework_info": {"id": {"value": "fw1"}, "name": "marathon", "webui_url": "http://marathon:8080"},
+                      "active": true, "reregistered_time": {"nanoseconds": 1500000000000000000},
+                      "allocated_resources": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 0.6}, "allocation_info": {"role": "web"}}],
+                      "offered_resources": [{"name": "mem", "type": "SCALAR", "scalar": {"value": 256}}]}],
+      "completed_frameworks": [{"framework_info": {"id": {"value": "fw2"}, "name": "batch"}}]
+    },
+    "get_agents": {"agents": [{
+      "agent_info": {"hostname": "agent1", "port": 5051, "id": {"value": "a1"},
+                     "attributes": [{"name": "rack", "type": "TEXT", "text": {"value": "r1"}}, {"name": "gen", "type": "SCALAR", "scalar": {"value": 2}}]},
+      "pid": "slave(1)@10.0.0.1:5051",
+      "total_resources": [
+        {"name": "cpus", "type": "SCALAR", "scalar": {"value": 4}},
+        {"name": "cpus", "type": "SCALAR", "scalar": {"value": 2}, "reservations": [{"role": "web"}]},
+        {"name": "ports", "type": "RANGES", "ranges": {"range": [{"begin": 31000, "end": 32000}]}}
+      ],
+      "allocated_resources": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 0.5}}]
+    }]}
+  }
+}`
+	var res v1Response
+	if err := json.Unmarshal([]byte(data), &res); err != nil {
+		t.Fatal(err)
+	}
+	var st state
+	if err := res.convert(&st); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(st.Slaves[0].UnreservedFull); n != 2 {
+		t.Errorf("got %d unreserved resources, want 2", n)
+	}
+	if n := len(st.Slaves[0].UsedFull); n != 1 {
+		t.Errorf("got %d used resources, want 1", n)
+	}
+	if n := len(st.Slaves[0].TotalFull); n != 3 {
+		t.Errorf("got %d resources, want 3", n)
+	}
+	st.Slaves[0].UnreservedFull = nil
+	st.Slaves[0].UsedFull = nil
+	st.Slaves[0].TotalFull = nil
+
+	want := state{
+		Frameworks: []framework{
+			// fw0 never reregistered, unlike fw1.
+			{ID: "fw0", Active: true},
+			{
+				ID: "fw1", Name: "marathon", WebUIURL: "http://marathon:8080", Active: true, ReregisteredTime: 1.5e9,
+				Used: resources{CPUs: 0.6}, Offered: resources{Mem: 256},
+				Tasks: []task{{
+					Name: "web", ID: "web.1", ExecutorID: "web", FrameworkID: "fw1", SlaveID: "a1", Role: "web",
+					State: "TASK_RUNNING", Resources: resources{CPUs: 0.5},
+				}},
+				Executors: []frameworkExecutor{{ID: "web", SlaveID: "a1", Resources: resources{CPUs: 0.1, Mem: 32}}},
+			},
+			{ID: "fw2", Name: "batch", Completed: []task{{Name: "batch", ID: "batch.1", FrameworkID: "fw2", State: "TASK_FINISHED"}}},
+			// Frameworks only known from their executors are listed last.
+			{ID: "fw3", Executors: []frameworkExecutor{{ID: "batch", SlaveID: "a1"}}},
+		},
+		Slaves: []slave{{
+			PID: "slave(1)@10.0.0.1:5051", Hostname: "agent1", Id: "a1", Port: 5051,
+			Used:       resources{CPUs: 0.5},
+			Unreserved: resources{CPUs: 4, Ports: ranges{{31000, 32000}}},
+			Total:      resources{CPUs: 6, Ports: ranges{{31000, 32000}}},
+			Reserved:   map[string]resources{"web": {CPUs: 2}},
+			Attributes: map[string]json.RawMessage{"rack": json.RawMessage(`"r1"`), "gen": json.RawMessage(`2`)},
+		}},
+	}
+	if !reflect.DeepEqual(st, want) {
+		t.Errorf("got: %+v, want: %+v", st, want)
+	}
+}
+
+func TestV1Response_ConvertMissingPayload(t *testing.T) {
+	res := v1Response{Type: "GET_VERSION"}
+	var m metricMap
+	if err := res.convert(&m); err == nil {
+		t.Error("expected an error for a response without get_metrics")
+	}
+}
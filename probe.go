@@ -0,0 +1,124 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// probeHandler serves /probe?target=<master URL>, collecting the metrics of
+// the given master on demand. The collectors of a target are built on its
+// first probe and reused afterwards, so HTTP clients and auth tokens are
+// cached per target, up to maxTargets targets probed last.
+//
+// Any target is probed, without credentials, unless allowed lists the
+// targets, which are then the only ones probed, with credentials.
+type probeHandler struct {
+	// newClient returns a client for url, which sends the credentials of
+	// the exporter if credentials is set
+	newClient  func(url string, m *targetMetrics, credentials bool) *httpClient
+	masterOpts masterOptions
+	allowed    map[string]bool
+	maxTargets int
+
+	mu      sync.Mutex
+	targets map[string]*list.Element
+	// lru orders the targets from the one probed last
+	lru *list.List
+}
+
+type probeTarget struct {
+	url      string
+	registry *prometheus.Registry
+	// clients are those of the collectors, whose idle connections are
+	// closed once the target is dropped
+	clients []*httpClient
+	// scrape serves the probes of the target one at a time
+	scrape scrapeScope
+}
+
+func newProbeHandler(newClient func(url string, m *targetMetrics, credentials bool) *httpClient, masterOpts masterOptions, allowed []string, maxTargets int) *probeHandler {
+	// Background fetches would go on for every target ever probed, and
+	// a probe waits for its /state anyway.
+	masterOpts.stateRefreshInterval = 0
+	h := &probeHandler{
+		newClient:  newClient,
+		masterOpts: masterOpts,
+		maxTargets: maxTargets,
+		targets:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+	if len(allowed) > 0 {
+		h.allowed = map[string]bool{}
+		for _, target := range allowed {
+			h.allowed[target] = true
+		}
+	}
+	return h
+}
+
+func (h *probeHandler) target(target string) (*probeTarget, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.targets[target]; ok {
+		h.lru.MoveToFront(e)
+		return e.Value.(*probeTarget), nil
+	}
+
+	log.WithField("target", target).Debug("creating collectors for probe target")
+	t := &probeTarget{url: target, registry: prometheus.NewRegistry()}
+	credentials := h.allowed[target]
+	err := registerMasterCollectors(context.Background(), t.registry, func(m *targetMetrics) fetcher {
+		client := h.newClient(target, m, credentials)
+		client.scrape = &t.scrape
+		t.clients = append(t.clients, client)
+		return client
+	}, h.masterOpts)
+	if err != nil {
+		return nil, err
+	}
+	h.targets[target] = h.lru.PushFront(t)
+	for h.maxTargets > 0 && h.lru.Len() > h.maxTargets {
+		evicted := h.lru.Remove(h.lru.Back()).(*probeTarget)
+		log.WithField("target", evicted.url).Debug("dropping collectors of probe target")
+		delete(h.targets, evicted.url)
+		for _, client := range evicted.clients {
+			client.CloseIdleConnections()
+		}
+	}
+	return t, nil
+}
+
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "target must be an http or https URL", http.StatusBadRequest)
+		return
+	}
+	if h.allowed != nil && !h.allowed[target] {
+		http.Error(w, "target is not allowed", http.StatusForbidden)
+		return
+	}
+
+	t, err := h.target(target)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"target": target,
+			"error":  err,
+		}).Error("Error creating collectors for probe target")
+		http.Error(w, "error creating collectors for target", http.StatusInternalServerError)
+		return
+	}
+	t.scrape.handler(promhttp.HandlerFor(t.registry, promhttp.HandlerOpts{})).ServeHTTP(w, r)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProbeHandler(t *testing.T) {
+	var authorization string
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`{"master/elected": 1}`))
+	}))
+	defer master.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"master/elected": 0}`))
+	}))
+	defer other.Close()
+
+	newClient := func(url string, m *targetMetrics, credentials bool) *httpClient {
+		auth := authInfo{}
+		if credentials {
+			auth = authInfo{username: "exporter", password: "secret"}
+		}
+		return mkHTTPClient(url, httpOptions{metrics: m}, auth, nil, nil)
+	}
+	probe := func(h *probeHandler, target string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/probe?target="+url.QueryEscape(target), nil))
+		return rec.Code
+	}
+
+	// Unlisted targets are probed without credentials, and the collectors
+	// of the target probed least recently are dropped.
+	h := newProbeHandler(newClient, masterOptions{}, nil, 1)
+	for _, tt := range []struct {
+		target string
+		want   int
+	}{
+		{"", http.StatusBadRequest},
+		{"ftp://master", http.StatusBadRequest},
+		{master.URL, http.StatusOK},
+		{other.URL, http.StatusOK},
+	} {
+		if got := probe(h, tt.target); got != tt.want {
+			t.Errorf("%q: got status %d, want %d", tt.target, got, tt.want)
+		}
+	}
+	if authorization != "" {
+		t.Errorf("got Authorization %q without an allow-list, want none", authorization)
+	}
+	if _, ok := h.targets[other.URL]; !ok || len(h.targets) != 1 {
+		t.Errorf("got targets %v, want only %s", h.targets, other.URL)
+	}
+
+	// Listed targets are the only ones probed, with credentials.
+	h = newProbeHandler(newClient, masterOptions{}, []string{master.URL}, 0)
+	if got := probe(h, other.URL); got != http.StatusForbidden {
+		t.Errorf("got status %d probing an unlisted target, want %d", got, http.StatusForbidden)
+	}
+	if got := probe(h, master.URL); got != http.StatusOK {
+		t.Errorf("got status %d probing a listed target, want %d", got, http.StatusOK)
+	}
+	if authorization == "" {
+		t.Error("got no Authorization probing a listed target")
+	}
+}
+
+func TestProbeHandler_EvictedConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	master := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"master/elected": 1}`))
+	}))
+	master.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	master.Start()
+	defer master.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"master/elected": 0}`))
+	}))
+	defer other.Close()
+
+	h := newProbeHandler(func(url string, m *targetMetrics, credentials bool) *httpClient {
+		return mkHTTPClient(url, httpOptions{metrics: m}, authInfo{}, nil, nil)
+	}, masterOptions{}, nil, 1)
+	for _, target := range []string{master.URL, other.URL} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/probe?target="+url.QueryEscape(target), nil))
+	}
+	// The kept-alive connection to the evicted target is closed by the
+	// exporter, not left to the server.
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("connection to the evicted target is still open")
+	}
+}
+
+func TestProbeHandler_StateRefreshInterval(t *testing.T) {
+	// Probes fetch /state themselves, rather than refreshing it in the
+	// background for every target probed.
+	h := newProbeHandler(nil, masterOptions{enableMasterState: true, stateRefreshInterval: time.Second}, nil, 0)
+	if h.masterOpts.stateRefreshInterval != 0 {
+		t.Errorf("got stateRefreshInterval %v, want 0", h.masterOpts.stateRefreshInterval)
+	}
+}
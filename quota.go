@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// quotaResponse is the response of the master /quota endpoint. Masters
+	// before 1.9 only list guarantees in infos, later ones also list
+	// guarantees and limits in configs.
+	quotaResponse struct {
+		Infos []struct {
+			Role      string         `json:"role"`
+			Guarantee []resourceInfo `json:"guarantee"`
+		} `json:"infos"`
+		Configs []struct {
+			Role       string                 `json:"role"`
+			Guarantees map[string]scalarValue `json:"guarantees"`
+			Limits     map[string]scalarValue `json:"limits"`
+		} `json:"configs"`
+	}
+
+	scalarValue struct {
+		Value float64 `json:"value"`
+	}
+
+	roleQuota struct {
+		guarantee resources
+		// limit is nil for roles without limits
+		limit *resources
+	}
+
+	quotaCollector struct {
+		fetcher
+		metrics map[prometheus.Collector]func(map[string]roleQuota, prometheus.Collector)
+	}
+)
+
+// quotas returns the quota of every role.
+func (q *quotaResponse) quotas() map[string]roleQuota {
+	quotas := map[string]roleQuota{}
+	for _, c := range q.Configs {
+		quota := roleQuota{guarantee: scalarResources(c.Guarantees)}
+		if len(c.Limits) > 0 {
+			limit := scalarResources(c.Limits)
+			quota.limit = &limit
+		}
+		quotas[c.Role] = quota
+	}
+	for _, info := range q.Infos {
+		if _, ok := quotas[info.Role]; !ok {
+			quotas[info.Role] = roleQuota{guarantee: sumResources(info.Guarantee, false)}
+		}
+	}
+	return quotas
+}
+
+func scalarResources(values map[string]scalarValue) resources {
+	return resources{
+		CPUs: values["cpus"].Value,
+		Mem:  values["mem"].Value,
+		Disk: values["disk"].Value,
+	}
+}
+
+func newQuotaCollector(fetcher fetcher, opts collectorOptions) prometheus.Collector {
+	memUnit := opts.unit()
+	metrics := map[prometheus.Collector]func(map[string]roleQuota, prometheus.Collector){
+		// Tells the roles with a quota from those without, which are missing.
+		gauge("role", "has_quota", "Roles with a quota configured, always 1", opts.roleLabels("role")...): func(quotas map[string]roleQuota, c prometheus.Collector) {
+			for role := range quotas {
+				c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role)...).Set(1)
+			}
+		},
+		gauge("quota", "guarantee_cpus", "CPUs guaranteed to the role by its quota (fractional)", opts.roleLabels("role")...): func(quotas map[string]roleQuota, c prometheus.Collector) {
+			for role, q := range quotas {
+				c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role)...).Set(q.guarantee.CPUs)
+			}
+		},
+		gauge("quota", memUnit.name("guarantee_mem_bytes"), memUnit.help("Memory guaranteed to the role by its quota in bytes"), opts.roleLabels("role")...): func(quotas map[string]roleQuota, c prometheus.Collector) {
+			for role, q := range quotas {
+				c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role)...).Set(memUnit.fromMiB(q.guarantee.Mem))
+			}
+		},
+		gauge("quota", "limit_cpus", "CPUs the role is limited to by its quota (fractional)", opts.roleLabels("role")...): func(quotas map[string]roleQuota, c prometheus.Collector) {
+			for role, q := range quotas {
+				if q.limit != nil {
+					c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role)...).Set(q.limit.CPUs)
+				}
+			}
+		},
+		gauge("quota", memUnit.name("limit_mem_bytes"), memUnit.help("Memory the role is limited to by its quota in bytes"), opts.roleLabels("role")...): func(quotas map[string]roleQuota, c prometheus.Collector) {
+			for role, q := range quotas {
+				if q.limit != nil {
+					c.(*prometheus.GaugeVec).WithLabelValues(opts.roleLabelValues(role, role)...).Set(memUnit.fromMiB(q.limit.Mem))
+				}
+			}
+		},
+	}
+	return &quotaCollector{fetcher, metrics}
+}
+
+func (c *quotaCollector) Collect(ch chan<- prometheus.Metric) {
+	var q quotaResponse
+	if !c.fetchAndDecode("/quota", &q) {
+		return
+	}
+	quotas := q.quotas()
+	for c, set := range c.metrics {
+		// Quotas can be removed, don't keep exporting them.
+		c.(*prometheus.GaugeVec).Reset()
+		set(quotas, c)
+		c.Collect(ch)
+	}
+}
+
+func (c *quotaCollector) Describe(ch chan<- *prometheus.Desc) {
+	for metric := range c.metrics {
+		metric.Describe(ch)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestQuotaResponse_Quotas(t *testing.T) {
+	data := `{
+  "infos": [
+    {"role": "web", "guarantee": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 1}}]},
+    {"role": "batch", "guarantee": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 2}},
+                                    {"name": "mem", "type": "SCALAR", "scalar": {"value": 1024}}]}
+  ],
+  "configs": [
+    {"role": "web", "guarantees": {"cpus": {"value": 1}, "mem": {"value": 512}}, "limits": {"cpus": {"value": 4}}}
+  ]
+}`
+	var q quotaResponse
+	if err := json.Unmarshal([]byte(data), &q); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]roleQuota{
+		"web":   {guarantee: resources{CPUs: 1, Mem: 512}, limit: &resources{CPUs: 4}},
+		"batch": {guarantee: resources{CPUs: 2, Mem: 1024}},
+	}
+	if got := q.quotas(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestQuotaCollector_HierarchicalRoles(t *testing.T) {
+	c := newQuotaCollector(fakeFetcher{
+		"/quota": `{"infos": [
+  {"role": "eng/team-a", "guarantee": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 1}}]},
+  {"role": "eng", "guarantee": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 2}}]}
+]}`,
+	}, collectorOptions{parentRoleLabel: true})
+	got := map[string]string{}
+	for _, m := range collectMetrics(c) {
+		if m.GetGauge().GetValue() != 0 {
+			got[labelValue(m, "role")] = labelValue(m, "parent_role")
+		}
+	}
+	want := map[string]string{"eng/team-a": "eng", "eng": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got roles: %v, want: %v", got, want)
+	}
+}
+
+func TestQuotaCollector_HasQuota(t *testing.T) {
+	c := newQuotaCollector(fakeFetcher{
+		"/quota": `{"configs": [
+  {"role": "web", "guarantees": {"cpus": {"value": 1}}},
+  {"role": "batch", "limits": {"cpus": {"value": 4}}}
+]}`,
+	}, collectorOptions{})
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+	got := map[string]float64{}
+	for m := range ch {
+		if !strings.Contains(m.Desc().String(), `"mesos_role_has_quota"`) {
+			continue
+		}
+		var pb dto.Metric
+		m.Write(&pb)
+		got[labelValue(&pb, "role")] = pb.GetGauge().GetValue()
+	}
+	if want := map[string]float64{"web": 1, "batch": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stateRefresher fetches /state in the background and serves the last state
+// decoded in place of fetching it, for the scrapes of large clusters not to
+// wait for, and time out on, a slow /state. Other endpoints are fetched as
+// usual.
+type stateRefresher struct {
+	fetcher
+	age *prometheus.Desc
+
+	mu      sync.Mutex
+	last    *state
+	fetched time.Time
+}
+
+func newStateRefresher(fetcher fetcher) *stateRefresher {
+	return &stateRefresher{
+		fetcher: fetcher,
+		age: prometheus.NewDesc(
+			"mesos_exporter_state_cache_age_seconds",
+			"Seconds since the /state the metrics are derived from was fetched in the background",
+			nil, nil),
+	}
+}
+
+// run refreshes the state every interval, starting right away, until ctx is
+// done.
+func (r *stateRefresher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.refresh()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh fetches /state, keeping the last state if the fetch fails.
+func (r *stateRefresher) refresh() {
+	var s state
+	if !r.fetcher.fetchAndDecode("/state", &s) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = &s
+	r.fetched = time.Now()
+}
+
+func (r *stateRefresher) fetchAndDecode(endpoint string, target interface{}) bool {
+	s, ok := target.(*state)
+	if endpoint != "/state" || !ok {
+		return r.fetcher.fetchAndDecode(endpoint, target)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		return false
+	}
+	// The collector filters and truncates the slaves and frameworks in
+	// place, which mustn't change the state kept.
+	*s = *r.last
+	s.Slaves = append([]slave(nil), r.last.Slaves...)
+	s.Frameworks = append([]framework(nil), r.last.Frameworks...)
+	return true
+}
+
+func (r *stateRefresher) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.age
+}
+
+func (r *stateRefresher) Collect(ch chan<- prometheus.Metric) {
+	r.mu.Lock()
+	fetched := r.fetched
+	r.mu.Unlock()
+
+	if !fetched.IsZero() {
+		ch <- prometheus.MustNewConstMetric(r.age, prometheus.GaugeValue, time.Since(fetched).Seconds())
+	}
+}
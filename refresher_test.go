@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countingFetcher counts the fetches of every endpoint.
+type countingFetcher struct {
+	fakeFetcher
+	fetches map[string]int
+}
+
+func (f *countingFetcher) fetchAndDecode(endpoint string, target interface{}) bool {
+	f.fetches[endpoint]++
+	return f.fakeFetcher.fetchAndDecode(endpoint, target)
+}
+
+func TestStateRefresher(t *testing.T) {
+	f := &countingFetcher{
+		fakeFetcher: fakeFetcher{
+			"/state":   `{"slaves": [{"pid": "s1", "active": false}, {"pid": "s2", "active": true}]}`,
+			"/version": `{"version": "1.7.2"}`,
+		},
+		fetches: map[string]int{},
+	}
+	r := newStateRefresher(f)
+	var s state
+	if r.fetchAndDecode("/state", &s) {
+		t.Error("got a state before the first refresh")
+	}
+	if got := len(collectMetrics(r)); got != 0 {
+		t.Errorf("got %d metrics before the first refresh, want none", got)
+	}
+
+	r.refresh()
+	c := newMasterStateCollector(r, masterStateOptions{onlyActiveSlaves: true}, collectorOptions{})
+	for i := 0; i < 2; i++ {
+		collectMetrics(c)
+	}
+	if want := map[string]int{"/state": 1}; !reflect.DeepEqual(f.fetches, want) {
+		t.Errorf("got fetches %v, want %v", f.fetches, want)
+	}
+	// Leaving out the inactive slave in one scrape doesn't change the
+	// state served to the next.
+	if !r.fetchAndDecode("/state", &s) || len(s.Slaves) != 2 || s.Slaves[0].PID != "s1" {
+		t.Errorf("got slaves %+v, want s1 and s2", s.Slaves)
+	}
+	if got := len(collectMetrics(r)); got != 1 {
+		t.Errorf("got %d metrics, want the cache age", got)
+	}
+
+	var vf versionFields
+	if !r.fetchAndDecode("/version", &vf) || f.fetches["/version"] != 1 {
+		t.Errorf("got %d fetches of /version, want 1", f.fetches["/version"])
+	}
+}
+
+// lockedFetcher counts the fetches of /state, which refreshers make in the
+// background.
+type lockedFetcher struct {
+	fakeFetcher
+	mu     sync.Mutex
+	states int
+}
+
+func (f *lockedFetcher) fetchAndDecode(endpoint string, target interface{}) bool {
+	if endpoint == "/state" {
+		f.mu.Lock()
+		f.states++
+		f.mu.Unlock()
+	}
+	return f.fakeFetcher.fetchAndDecode(endpoint, target)
+}
+
+func (f *lockedFetcher) fetchedStates() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.states
+}
+
+func TestStateRefresher_Targets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two clusters, as with -masters, each refreshing its own state.
+	fetchers := map[string]*lockedFetcher{}
+	registries := map[string]*prometheus.Registry{}
+	for _, cluster := range []string{"a", "b"} {
+		f := &lockedFetcher{fakeFetcher: fakeFetcher{
+			"/state": `{"slaves": [{"pid": "slave(1)@` + cluster + `:5051", "resources": {"cpus": 1}}]}`,
+		}}
+		registry := prometheus.NewRegistry()
+		err := registerMasterCollectors(ctx, registry, func(m *targetMetrics) fetcher {
+			return f
+		}, masterOptions{enableMasterState: true, stateRefreshInterval: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fetchers[cluster], registries[cluster] = f, registry
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cluster, f := range fetchers {
+		for f.fetchedStates() < 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: got %d fetches of /state, want at least 2", cluster, f.fetchedStates())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for cluster, registry := range registries {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var slaves []string
+		for _, mf := range mfs {
+			if mf.GetName() == "mesos_slave_cpus" {
+				for _, m := range mf.Metric {
+					slaves = append(slaves, labelValue(m, "slave"))
+				}
+			}
+		}
+		if want := []string{"slave(1)@" + cluster + ":5051"}; !reflect.DeepEqual(slaves, want) {
+			t.Errorf("%s: got slaves %v, want %v", cluster, slaves, want)
+		}
+	}
+
+	// The refreshers stop with ctx.
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	stopped := map[string]int{}
+	for cluster, f := range fetchers {
+		stopped[cluster] = f.fetchedStates()
+	}
+	time.Sleep(50 * time.Millisecond)
+	for cluster, f := range fetchers {
+		if got := f.fetchedStates(); got != stopped[cluster] {
+			t.Errorf("%s: got %d fetches of /state after stopping, want %d", cluster, got, stopped[cluster])
+		}
+	}
+}
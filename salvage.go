@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// decodeFields decodes the JSON object read from r into the struct target
+// points to, field by field. If r is cut short, target still gets the fields
+// received in full, and the number of those is returned along with the error.
+func decodeFields(r io.Reader, target interface{}) (int, error) {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return 0, fmt.Errorf("got %T, want a pointer to a struct", target)
+	}
+	v = v.Elem()
+
+	eof := &eofReader{r: r}
+	dec := json.NewDecoder(eof)
+	if t, err := dec.Token(); err != nil {
+		return 0, err
+	} else if t != json.Delim('{') {
+		return 0, fmt.Errorf("got %v, want a JSON object", t)
+	}
+
+	fields := 0
+	var err error
+	for dec.More() {
+		var key json.Token
+		if key, err = dec.Token(); err != nil {
+			break
+		}
+		// The decoder reads a value in full before storing it, so a
+		// field cut short is left alone.
+		var value interface{} = &json.RawMessage{}
+		if f := fieldByJSONName(v, key.(string)); f.IsValid() {
+			value = f.Addr().Interface()
+		}
+		if err = dec.Decode(value); err != nil {
+			break
+		}
+		fields++
+	}
+	if err == nil {
+		_, err = dec.Token()
+	}
+	// Past the end of r, the decoder reports syntax errors.
+	if err != nil && eof.eof {
+		err = io.ErrUnexpectedEOF
+	}
+	return fields, err
+}
+
+// fieldByJSONName returns the field of the struct v that encoding/json
+// decodes the object key name into, or the zero Value if there is none.
+func fieldByJSONName(v reflect.Value, name string) reflect.Value {
+	var folded reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return v.Field(i)
+		}
+		// Like encoding/json, prefer an exact match to a case-insensitive one.
+		if !folded.IsValid() && strings.EqualFold(tag, name) {
+			folded = v.Field(i)
+		}
+	}
+	return folded
+}
+
+// truncated tells if err is a decode error caused by the end of the input.
+func truncated(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// eofReader records whether r was read to its end.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDecodeFields(t *testing.T) {
+	for _, tt := range []struct {
+		data      string
+		fields    int
+		slaves    int
+		truncated bool
+	}{
+		{`{"slaves": [{"pid": "s1"}], "frameworks": []}`, 2, 1, false},
+		{`{"hostname": "m1", "Slaves": [{"pid": "s1"}]}`, 2, 1, false},
+		{`{"slaves": [{"pid": "s1"}, {"pid": "s2"}], "frameworks": [{"id": "f1"}, {"i`, 1, 2, true},
+		{`{"slaves": [{"pid": "s1"}, {"pid": "s2"}]`, 1, 2, true},
+		{`{"slaves": [{"pid": "s1"}, {"pi`, 0, 0, true},
+	} {
+		var s state
+		fields, err := decodeFields(strings.NewReader(tt.data), &s)
+		if fields != tt.fields || len(s.Slaves) != tt.slaves || truncated(err) != tt.truncated {
+			t.Errorf("%s: got %d fields, %d slaves, err %v, want %d fields, %d slaves, truncated %v",
+				tt.data, fields, len(s.Slaves), err, tt.fields, tt.slaves, tt.truncated)
+		}
+	}
+
+	if _, err := decodeFields(strings.NewReader(`[]`), &state{}); err == nil {
+		t.Error("got no error decoding an array")
+	}
+	if _, err := decodeFields(strings.NewReader(`{}`), &[]slave{}); err == nil {
+		t.Error("got no error decoding into a slice")
+	}
+}
+
+func TestFetchAndDecode_SalvageTruncatedState(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"slaves": [{"pid": "s1"}], "frameworks": [{"id": "f1", "tas`))
+	}))
+	defer srv.Close()
+
+	for _, salvage := range []bool{false, true} {
+		metrics, err := newTargetMetrics(prometheus.NewRegistry(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &httpClient{Client: *srv.Client(), url: srv.URL, salvageTruncatedState: salvage, metrics: metrics}
+		var s state
+		if ok := client.fetchAndDecode("/state", &s); ok != salvage {
+			t.Errorf("salvage=%v: got success %v", salvage, ok)
+		}
+		if salvage && len(s.Slaves) != 1 {
+			t.Errorf("got %d slaves, want 1", len(s.Slaves))
+		}
+		// Salvaged or not, the fetch is reported as failed.
+		if got := collectMetrics(metrics.up.WithLabelValues("/state"))[0].GetGauge().GetValue(); got != 0 {
+			t.Errorf("salvage=%v: got mesos_up %v, want 0", salvage, got)
+		}
+		if got := collectMetrics(metrics.lastScrapeErrors.WithLabelValues("/state"))[0].GetGauge().GetValue(); got != 1 {
+			t.Errorf("salvage=%v: got mesos_exporter_scrape_errors_last %v, want 1", salvage, got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type scrapeIDKey struct{}
+
+// scrapeIDFromContext returns the correlation id withScrapeID gave the
+// request of ctx, or "" if it has none.
+func scrapeIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(scrapeIDKey{}).(string)
+	return id
+}
+
+// newScrapeID returns a random (version 4) UUID.
+func newScrapeID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// withScrapeID assigns a new correlation id to every scrape served by h,
+// stored in the context of its request.
+func withScrapeID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := newScrapeID()
+		log.WithFields(log.Fields{
+			"scrape_id": id,
+			"path":      r.URL.Path,
+		}).Debug("starting scrape")
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scrapeIDKey{}, id)))
+	})
+}
+
+// scrapeScope hands the correlation id of a scrape to the clients of the
+// collectors it serves, which are not handed the request. The collectors
+// keep per-scrape state, so the scrapes of a scope are served one at a time
+// and the id is that of the scrape the clients fetch for.
+type scrapeScope struct {
+	serve sync.Mutex
+
+	mu sync.Mutex
+	id string
+}
+
+// handler serves the scrapes of h one at a time, each with the id of its
+// request.
+func (s *scrapeScope) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serve.Lock()
+		defer s.serve.Unlock()
+		s.set(scrapeIDFromContext(r.Context()))
+		defer s.set("")
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *scrapeScope) set(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id = id
+}
+
+// current returns the id of the scrape in progress, or "" outside of
+// scrapes, such as for background fetches.
+func (s *scrapeScope) current() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithScrapeID(t *testing.T) {
+	var got []string
+	h := withScrapeID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, scrapeIDFromContext(r.Context()))
+	}))
+	for i := 0; i < 2; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, id := range got {
+		if !uuid.MatchString(id) {
+			t.Errorf("got scrape id %q, want a UUID", id)
+		}
+	}
+	if got[0] == got[1] {
+		t.Errorf("got the same id %q for two scrapes", got[0])
+	}
+}
+
+func TestScrapeScope(t *testing.T) {
+	var mu sync.Mutex
+	sent := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent[r.URL.Path] = r.Header.Get("X-Request-ID")
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	// The first scrape fetches again once a scrape of another scope has
+	// started, which must not take over its id.
+	var metrics, probe scrapeScope
+	first := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, sendRequestID: true, scrape: &metrics}, authInfo{}, nil, nil)
+	second := mkHTTPClient(ts.URL, httpOptions{timeout: time.Second, sendRequestID: true, scrape: &probe}, authInfo{}, nil, nil)
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		withScrapeID(metrics.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			first.fetchAndDecode("/before", &struct{}{})
+			<-started
+			first.fetchAndDecode("/after", &struct{}{})
+		}))).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	}()
+	withScrapeID(probe.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		second.fetchAndDecode("/probed", &struct{}{})
+	}))).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/probe", nil))
+	<-done
+
+	if sent["/before"] == "" || sent["/probed"] == "" {
+		t.Fatalf("got X-Request-ID %v, want one for every fetch", sent)
+	}
+	if sent["/after"] != sent["/before"] {
+		t.Errorf("got X-Request-ID %q once another scrape started, want %q", sent["/after"], sent["/before"])
+	}
+	if sent["/probed"] == sent["/before"] {
+		t.Errorf("got the same X-Request-ID %q for two scrapes", sent["/probed"])
+	}
+	if got := metrics.current(); got != "" {
+		t.Errorf("got scrape id %q once the scrape was served, want none", got)
+	}
+}
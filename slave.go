@@ -8,7 +8,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func newSlaveCollector(httpClient *httpClient) prometheus.Collector {
+func newSlaveCollector(fetcher fetcher, opts collectorOptions) prometheus.Collector {
 	metrics := map[prometheus.Collector]metricsCollectorFunctor{
 		// CPU/Disk/Mem resources in free/used
 		gauge("slave", "cpus", "Current CPU resources in cluster.", "type"): func(m metricMap, c prometheus.Collector) error {
@@ -432,9 +432,10 @@ func newSlaveCollector(httpClient *httpClient) prometheus.Collector {
 		newSettableCounter("slave",
 			"container_launch_errors",
 			"Total number of container launch errors"): func(m metricMap, c prometheus.Collector) error {
-			errors, ok := m["slave/container_launch_errors"]
-			if !ok {
-				log.WithField("metric", "slave/container_launch_errors").Warn(LogErrNotFoundInMap)
+			// Not reported by every Mesos version
+			errors, err := m.optional("slave/container_launch_errors")
+			if err != nil {
+				return err
 			}
 			c.(*settableCounter).Set(errors)
 			return nil
@@ -527,5 +528,5 @@ func newSlaveCollector(httpClient *httpClient) prometheus.Collector {
 
 		// END
 	}
-	return newStandardCollector(httpClient, metrics)
+	return newStandardCollector(fetcher, metrics, opts)
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// container is an entry of the agent /containers endpoint.
+	container struct {
+		ContainerID  string `json:"container_id"`
+		ExecutorID   string `json:"executor_id"`
+		ExecutorName string `json:"executor_name"`
+		FrameworkID  string `json:"framework_id"`
+		Source       string `json:"source"`
+	}
+
+	slaveContainersCollector struct {
+		fetcher
+		containers prometheus.Gauge
+	}
+)
+
+func newSlaveContainersCollector(fetcher fetcher) prometheus.Collector {
+	return &slaveContainersCollector{
+		fetcher: fetcher,
+		containers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Help:      "Current number of containers on the agent",
+			Namespace: "mesos",
+			Subsystem: "agent",
+			Name:      "containers",
+		}),
+	}
+}
+
+func (c *slaveContainersCollector) Collect(ch chan<- prometheus.Metric) {
+	var containers []container
+	if !c.fetchAndDecode("/containers", &containers) {
+		return
+	}
+	c.containers.Set(float64(len(containers)))
+	c.containers.Collect(ch)
+}
+
+func (c *slaveContainersCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.containers.Describe(ch)
+}
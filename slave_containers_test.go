@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSlaveContainersCollector(t *testing.T) {
+	c := newSlaveContainersCollector(fakeFetcher{
+		"/containers": `[
+  {"container_id": "c1", "executor_id": "e1", "framework_id": "f1", "source": "s1"},
+  {"container_id": "c2", "executor_id": "e2", "framework_id": "f1", "source": "s2"}
+]`,
+	})
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+	var got []float64
+	for m := range ch {
+		var pb dto.Metric
+		m.Write(&pb)
+		got = append(got, pb.GetGauge().GetValue())
+	}
+	if len(got) != 1 || got[0] != 2 {
+		t.Errorf("got %v, want [2]", got)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -49,142 +51,171 @@ type (
 		NetTxDropped float64 `json:"net_tx_dropped"`
 		NetTxErrors  float64 `json:"net_tx_errors"`
 		NetTxPackets float64 `json:"net_tx_packets"`
+
+		// present holds the fields of the response, as the agent only
+		// reports the statistics its isolators collect.
+		present map[string]bool
 	}
 
 	slaveCollector struct {
-		*httpClient
+		fetcher
 		metrics map[*prometheus.Desc]metric
 	}
 
+	// metric is read with get from field of the statistics of executors,
+	// and skipped for executors lacking the field instead of reported as 0.
 	metric struct {
 		valueType prometheus.ValueType
 		get       func(*statistics) float64
+		field     string
 	}
 )
 
-func newSlaveMonitorCollector(httpClient *httpClient) prometheus.Collector {
+func (s *statistics) UnmarshalJSON(data []byte) error {
+	type plain statistics
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	s.present = make(map[string]bool, len(fields))
+	for field := range fields {
+		s.present[field] = true
+	}
+	return nil
+}
+
+func newSlaveMonitorCollector(fetcher fetcher) prometheus.Collector {
 	labels := []string{"id", "framework_id", "source"}
 
 	return &slaveCollector{
-		httpClient: httpClient,
+		fetcher: fetcher,
 		metrics: map[*prometheus.Desc]metric{
 			// Processes
 			prometheus.NewDesc(
 				"mesos_agent_processes",
 				"Current number of processes",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.Processes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.Processes }, "processes"},
 			prometheus.NewDesc(
 				"mesos_agent_threads",
 				"Current number of threads",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.Threads }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.Threads }, "threads"},
 
 			// CPU
 			prometheus.NewDesc(
 				"mesos_agent_cpus_limit",
 				"Current limit of CPUs for task",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.CpusLimit }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.CpusLimit }, "cpus_limit"},
 			prometheus.NewDesc(
 				"mesos_agent_cpu_system_seconds_total",
 				"Total system CPU seconds",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusSystemTimeSecs }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusSystemTimeSecs }, "cpus_system_time_secs"},
 			prometheus.NewDesc(
 				"mesos_agent_cpu_user_seconds_total",
 				"Total user CPU seconds",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusUserTimeSecs }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusUserTimeSecs }, "cpus_user_time_secs"},
 			prometheus.NewDesc(
 				"mesos_agent_cpu_throttled_seconds_total",
 				"Total time CPU was throttled due to CFS bandwidth control",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusThrottledTimeSecs }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusThrottledTimeSecs }, "cpus_throttled_time_secs"},
 			prometheus.NewDesc(
 				"mesos_agent_cpu_nr_periods_total",
 				"Total number of elapsed CFS enforcement intervals",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusNrPeriods }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusNrPeriods }, "cpus_nr_periods"},
 			prometheus.NewDesc(
 				"mesos_agent_cpu_nr_throttled_total",
 				"Total number of throttled CFS enforcement intervals.",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusNrThrottled }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.CpusNrThrottled }, "cpus_nr_throttled"},
 
 			// Memory
 			prometheus.NewDesc(
 				"mesos_agent_mem_anon_bytes",
 				"Current anonymous memory in bytes",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemAnonBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemAnonBytes }, "mem_anon_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_limit_bytes",
 				"Current memory limit in bytes",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemLimitBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemLimitBytes }, "mem_limit_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_rss_bytes",
 				"Current rss memory usage",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemRssBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemRssBytes }, "mem_rss_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_total_bytes",
 				"Current total memory usage",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemTotalBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemTotalBytes }, "mem_total_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_cache_bytes",
 				"Current page cache memory usage",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemCacheBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemCacheBytes }, "mem_cache_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_swap_bytes",
 				"Current swap usage",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemSwapBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemSwapBytes }, "mem_swap_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_file_bytes",
 				"Current file bytes count",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemFileBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemFileBytes }, "mem_file_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_mapped_file_bytes",
 				"Current memory mapped file bytes count",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemMappedFileBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemMappedFileBytes }, "mem_mapped_file_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_unevictable_bytes",
 				"Current memory unevictable bytes count",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemUnevictableBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.MemUnevictableBytes }, "mem_unevictable_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_low_pressure_counter",
 				"Low pressure counter value",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.MemLowPressureCounter }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.MemLowPressureCounter }, "mem_low_pressure_counter"},
 			prometheus.NewDesc(
 				"mesos_agent_mem_medium_pressure_counter",
 				"Medium pressure counter value",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.MemMediumPressureCounter }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.MemMediumPressureCounter }, "mem_medium_pressure_counter"},
 			prometheus.NewDesc(
-				"mesos_agent_critical_low_pressure_counter",
+				"mesos_agent_mem_critical_pressure_counter",
 				"Critical pressure counter value",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.MemCriticalPressureCounter }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.MemCriticalPressureCounter }, "mem_critical_pressure_counter"},
+			// Misnamed, kept for the dashboards and alerts using it.
+			prometheus.NewDesc(
+				"mesos_agent_critical_low_pressure_counter",
+				"Critical pressure counter value. Deprecated, use mesos_agent_mem_critical_pressure_counter",
+				labels, nil,
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.MemCriticalPressureCounter }, "mem_critical_pressure_counter"},
 
 			// Disk
 			prometheus.NewDesc(
 				"mesos_agent_disk_limit_bytes",
 				"Current disk limit in bytes",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.DiskLimitBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.DiskLimitBytes }, "disk_limit_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_disk_used_bytes",
 				"Current disk usage",
 				labels, nil,
-			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.DiskUsedBytes }},
+			): metric{prometheus.GaugeValue, func(s *statistics) float64 { return s.DiskUsedBytes }, "disk_used_bytes"},
 
 			// Network
 			// - RX
@@ -192,43 +223,43 @@ func newSlaveMonitorCollector(httpClient *httpClient) prometheus.Collector {
 				"mesos_agent_network_receive_bytes_total",
 				"Total bytes received",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxBytes }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxBytes }, "net_rx_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_network_receive_dropped_total",
 				"Total packets dropped while receiving",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxDropped }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxDropped }, "net_rx_dropped"},
 			prometheus.NewDesc(
 				"mesos_agent_network_receive_errors_total",
 				"Total errors while receiving",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxErrors }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxErrors }, "net_rx_errors"},
 			prometheus.NewDesc(
 				"mesos_agent_network_receive_packets_total",
 				"Total packets received",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxPackets }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetRxPackets }, "net_rx_packets"},
 			// - TX
 			prometheus.NewDesc(
 				"mesos_agent_network_transmit_bytes_total",
 				"Total bytes transmitted",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxBytes }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxBytes }, "net_tx_bytes"},
 			prometheus.NewDesc(
 				"mesos_agent_network_transmit_dropped_total",
 				"Total packets dropped while transmitting",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxDropped }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxDropped }, "net_tx_dropped"},
 			prometheus.NewDesc(
 				"mesos_agent_network_transmit_errors_total",
 				"Total errors while transmitting",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxErrors }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxErrors }, "net_tx_errors"},
 			prometheus.NewDesc(
 				"mesos_agent_network_transmit_packets_total",
 				"Total packets transmitted",
 				labels, nil,
-			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxPackets }},
+			): metric{prometheus.CounterValue, func(s *statistics) float64 { return s.NetTxPackets }, "net_tx_packets"},
 		},
 	}
 }
@@ -238,7 +269,13 @@ func (c *slaveCollector) Collect(ch chan<- prometheus.Metric) {
 	c.fetchAndDecode("/monitor/statistics", &stats)
 
 	for _, exec := range stats {
+		if exec.Statistics == nil {
+			continue
+		}
 		for desc, m := range c.metrics {
+			if !exec.Statistics.present[m.field] {
+				continue
+			}
 			ch <- prometheus.MustNewConstMetric(desc, m.valueType, m.get(exec.Statistics), exec.ID, exec.FrameworkID, exec.Source)
 		}
 	}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSlaveMonitorCollector_MissingFields(t *testing.T) {
+	c := newSlaveMonitorCollector(fakeFetcher{
+		"/monitor/statistics": `[
+  {"executor_id": "e1", "framework_id": "f1", "source": "s1",
+   "statistics": {"cpus_limit": 1.1, "disk_limit_bytes": 1073741824, "disk_used_bytes": 52428800}},
+  {"executor_id": "e2", "framework_id": "f1", "source": "s2",
+   "statistics": {"cpus_limit": 0.5}},
+  {"executor_id": "e3", "framework_id": "f1", "source": "s3"}
+]`,
+	})
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+
+	fqName := regexp.MustCompile(`fqName: "(\w+)"`)
+	got := map[string]float64{}
+	for m := range ch {
+		var pb dto.Metric
+		m.Write(&pb)
+		name := fqName.FindStringSubmatch(m.Desc().String())[1]
+		got[fmt.Sprintf("%s{%s}", name, labelValue(&pb, "id"))] = pb.GetGauge().GetValue()
+	}
+	want := map[string]float64{
+		"mesos_agent_cpus_limit{e1}":       1.1,
+		"mesos_agent_disk_limit_bytes{e1}": 1 << 30,
+		"mesos_agent_disk_used_bytes{e1}":  50 << 20,
+		"mesos_agent_cpus_limit{e2}":       0.5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSlaveMonitorCollector_CriticalPressure(t *testing.T) {
+	c := newSlaveMonitorCollector(fakeFetcher{
+		"/monitor/statistics": `[{"executor_id": "e1", "framework_id": "f1", "source": "s1",
+  "statistics": {"mem_critical_pressure_counter": 3}}]`,
+	})
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+
+	var names []string
+	for m := range ch {
+		var pb dto.Metric
+		m.Write(&pb)
+		if got := pb.GetCounter().GetValue(); got != 3 {
+			t.Errorf("%s: got %v, want 3", m.Desc(), got)
+		}
+		names = append(names, m.Desc().String())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || !strings.Contains(names[0], `"mesos_agent_critical_low_pressure_counter"`) ||
+		!strings.Contains(names[1], `"mesos_agent_mem_critical_pressure_counter"`) {
+		t.Errorf("got %v, want the counter under both names", names)
+	}
+}
@@ -89,30 +89,20 @@ func newSlaveStateCollector(httpClient *httpClient, userTaskLabelList []string,
 	}
 
 	if len(slaveAttributeLabelList) > 0 {
-		normalisedAttributeLabels := append(normaliseLabelList(slaveAttributeLabelList), "id")
+		normalisedAttributeLabels := normaliseLabelList(slaveAttributeLabelList)
+		slaveAttributesLabelsExport := append(normalisedAttributeLabels, "id")
 
 		c.metrics[prometheus.NewDesc(
 			prometheus.BuildFQName("mesos", "slave", "attributes"),
 			"Attributes assigned to slaves",
-			normalisedAttributeLabels,
+			slaveAttributesLabelsExport,
 			nil)] = slaveMetric{prometheus.CounterValue,
 			func(st *slaveState) []metricValue {
 				slaveAttributes := prometheus.Labels{}
-
-				for _, label := range normalisedAttributeLabels {
-					slaveAttributes[label] = ""
-				}
+				attributeLabels(slaveAttributes, st.Attributes, normalisedAttributeLabels)
 				slaveAttributes["id"] = st.ID
-				for key, value := range st.Attributes {
-					normalisedLabel := normaliseLabel(key)
-					if stringInSlice(normalisedLabel, normalisedAttributeLabels) {
-						if attribute, err := attributeString(value); err == nil {
-							slaveAttributes[normalisedLabel] = attribute
-						}
-					}
-				}
 
-				return []metricValue{{1, getLabelValuesFromMap(slaveAttributes, normalisedAttributeLabels)}}
+				return []metricValue{{1, getLabelValuesFromMap(slaveAttributes, slaveAttributesLabelsExport)}}
 			},
 		}
 	}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slaveVersionCollector fetches the version of every agent registered with
+// the master, to find the agents left behind by an upgrade.
+type slaveVersionCollector struct {
+	fetcher
+	// fetchVersion fetches the /version of the agent at the given URL
+	fetchVersion func(url string, vf *versionFields) bool
+	scheme       string
+	fanout       semaphore
+	metric       *prometheus.GaugeVec
+}
+
+func newSlaveVersionCollector(httpClient *httpClient) prometheus.Collector {
+	// Agents are expected to be served like the master.
+	scheme := "http"
+	if u, err := url.Parse(httpClient.url); err == nil && u.Scheme == "https" {
+		scheme = u.Scheme
+	}
+	return &slaveVersionCollector{
+		fetcher: httpClient,
+		fetchVersion: func(url string, vf *versionFields) bool {
+			// Unlike fetchAndDecode, leave mesos_up and the clock skew of
+			// the master alone, and account errors apart from those of
+			// the master /version.
+			ok, _ := httpClient.request(url, "/slave/version", "GET", "/version", nil, vf, nil)
+			return ok
+		},
+		scheme: scheme,
+		fanout: httpClient.fanout,
+		metric: gauge("slave", "version_info", "Mesos version of the slave, always 1", "slave", "version"),
+	}
+}
+
+func (c *slaveVersionCollector) Collect(ch chan<- prometheus.Metric) {
+	var s state
+	if !c.fetchAndDecode("/slaves", &s) {
+		return
+	}
+
+	versions := make([]string, len(s.Slaves))
+	c.fanout.forEach(len(s.Slaves), func(i int) {
+		var vf versionFields
+		if u := s.Slaves[i].url(c.scheme); u != "" && c.fetchVersion(u, &vf) {
+			versions[i] = vf.Version
+		}
+	})
+
+	// Agents come and go, and are upgraded.
+	c.metric.Reset()
+	for i, version := range versions {
+		// Agents that didn't respond are left out.
+		if version != "" {
+			c.metric.WithLabelValues(sanitiseLabelValue(s.Slaves[i].PID), sanitiseLabelValue(version)).Set(1)
+		}
+	}
+	c.metric.Collect(ch)
+}
+
+func (c *slaveVersionCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.metric.Describe(ch)
+}
+
+// url returns the base URL of a slave from its PID, such as
+// slave(1)@10.0.0.1:5051.
+func (s slave) url(scheme string) string {
+	i := strings.LastIndex(s.PID, "@")
+	if i < 0 {
+		return ""
+	}
+	return scheme + "://" + s.PID[i+1:]
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSlaveVersionCollector(t *testing.T) {
+	versions := map[string]string{
+		"http://10.0.0.1:5051": "1.7.2",
+		"http://10.0.0.2:5051": "1.9.0",
+	}
+	c := &slaveVersionCollector{
+		fetcher: fakeFetcher{
+			"/slaves": `{"slaves": [{"pid": "slave(1)@10.0.0.1:5051"}, {"pid": "slave(1)@10.0.0.2:5051"}, {"pid": "slave(1)@10.0.0.3:5051"}]}`,
+		},
+		fetchVersion: func(url string, vf *versionFields) bool {
+			vf.Version = versions[url]
+			return vf.Version != ""
+		},
+		scheme: "http",
+		fanout: newSemaphore(2),
+		metric: gauge("slave", "version_info", "", "slave", "version"),
+	}
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+	got := map[string]string{}
+	for m := range ch {
+		var pb dto.Metric
+		m.Write(&pb)
+		got[labelValue(&pb, "slave")] = labelValue(&pb, "version")
+	}
+	want := map[string]string{
+		"slave(1)@10.0.0.1:5051": "1.7.2",
+		"slave(1)@10.0.0.2:5051": "1.9.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestNewSlaveVersionCollector_Scheme(t *testing.T) {
+	for url, want := range map[string]string{
+		"http://10.0.0.1:5050":         "http",
+		"https://10.0.0.1:5050":        "https",
+		"https://[2001:db8::1]:5050":   "https",
+		"http://[2001:db8::1]:5050/":   "http",
+		"https://master.mesos:5050/x/": "https",
+	} {
+		c := newSlaveVersionCollector(mkHTTPClient(url, httpOptions{}, authInfo{}, nil, nil)).(*slaveVersionCollector)
+		if c.scheme != want {
+			t.Errorf("%s: got scheme %s, want %s", url, c.scheme, want)
+		}
+	}
+}
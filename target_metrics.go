@@ -0,0 +1,212 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// scrapeErrorsLastName is the name of the gauge telling whether the last
+// fetch of an endpoint failed, which warmUp reads the failures from.
+const scrapeErrorsLastName = "mesos_exporter_scrape_errors_last"
+
+// targetMetrics report the fetches from a master or agent. Every target gets
+// its own, registered next to its collectors, so that the clusters of
+// -masters and the targets of /probe don't overwrite each other's series.
+// The methods do nothing on a nil *targetMetrics, as used by tests.
+type targetMetrics struct {
+	up                *prometheus.GaugeVec
+	lastScrapeErrors  *prometheus.GaugeVec
+	lastScrapeSuccess *prometheus.GaugeVec
+	lastResponseBytes *prometheus.GaugeVec
+	circuitState      *prometheus.GaugeVec
+	// clockSkew is only set for masters
+	clockSkew prometheus.Gauge
+
+	// The auth metrics are only registered once a client of the target
+	// uses strict mode.
+	registerer         prometheus.Registerer
+	authOnce           sync.Once
+	authStrictMode     prometheus.Gauge
+	authTokenIssued    prometheus.Gauge
+	authTokenExpiry    prometheus.Gauge
+	authTokenReuses    prometheus.Counter
+	authTokenRefreshes prometheus.Counter
+	authHealthy        prometheus.Gauge
+}
+
+// newTargetMetrics returns the metrics of a master, or of an agent, and
+// registers them with registerer.
+func newTargetMetrics(registerer prometheus.Registerer, master bool) (*targetMetrics, error) {
+	m := &targetMetrics{
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "mesos",
+			Name:      "up",
+			Help:      "1 if the last fetch of the endpoint succeeded, 0 if it failed or was skipped by the circuit breaker.",
+		}, []string{"endpoint"}),
+		lastScrapeErrors: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: scrapeErrorsLastName,
+			Help: "1 if the last fetch of the endpoint failed, 0 if it succeeded.",
+		}, []string{"endpoint"}),
+		lastScrapeSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "last_scrape_success_timestamp_seconds",
+			Help:      "Unix time of the last successful fetch of the endpoint.",
+		}, []string{"endpoint"}),
+		lastResponseBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "last_response_bytes",
+			Help:      "Size in bytes of the last response body decoded from the endpoint.",
+		}, []string{"endpoint"}),
+		circuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "circuit_state",
+			Help:      "State of the circuit breaker of the endpoint: 0 closed, 1 open, 2 half-open.",
+		}, []string{"endpoint"}),
+		registerer: registerer,
+		authStrictMode: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "auth_strict_mode",
+			Help:      "1 if a client uses strict mode authentication, 0 otherwise.",
+		}),
+		authTokenIssued: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "auth_token_issued_seconds",
+			Help:      "Unix time at which the last strict mode login token was created.",
+		}),
+		authTokenExpiry: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "auth_token_expiry_seconds",
+			Help:      "Unix time at which the last strict mode login token expires.",
+		}),
+		authTokenReuses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mesos_exporter",
+			Name:      "auth_token_reuse_total",
+			Help:      "Total number of requests authenticated with a cached strict mode token.",
+		}),
+		authTokenRefreshes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mesos_exporter",
+			Name:      "auth_token_refresh_total",
+			Help:      "Total number of strict mode logins to refresh the token.",
+		}),
+		authHealthy: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "auth_healthy",
+			Help:      "1 if the last strict mode login succeeded, 0 if it failed.",
+		}),
+	}
+	collectors := []prometheus.Collector{m.up, m.lastScrapeErrors, m.lastScrapeSuccess, m.lastResponseBytes, m.circuitState, m.authStrictMode}
+	if master {
+		m.clockSkew = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos_exporter",
+			Name:      "master_clock_skew_seconds",
+			Help:      "Seconds the clock of the master, going by the Date header of its last response, is ahead of the local clock, accurate to about a second.",
+		})
+		collectors = append(collectors, m.clockSkew)
+	}
+	for _, c := range collectors {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// enableAuth registers the auth metrics, once a client uses strict mode.
+func (m *targetMetrics) enableAuth() {
+	if m == nil {
+		return
+	}
+	m.authOnce.Do(func() {
+		for _, c := range []prometheus.Collector{m.authTokenIssued, m.authTokenExpiry, m.authTokenReuses, m.authTokenRefreshes, m.authHealthy} {
+			if err := m.registerer.Register(c); err != nil {
+				log.WithField("error", err).Error("Error registering auth metrics")
+			}
+		}
+		m.authStrictMode.Set(1)
+	})
+}
+
+// fetched records the outcome of a fetch of endpoint.
+func (m *targetMetrics) fetched(endpoint string, ok bool) {
+	if m == nil {
+		return
+	}
+	if ok {
+		m.lastScrapeErrors.WithLabelValues(endpoint).Set(0)
+		m.lastScrapeSuccess.WithLabelValues(endpoint).SetToCurrentTime()
+		m.up.WithLabelValues(endpoint).Set(1)
+	} else {
+		m.lastScrapeErrors.WithLabelValues(endpoint).Set(1)
+		m.up.WithLabelValues(endpoint).Set(0)
+	}
+}
+
+// skipped records that the circuit breaker of endpoint skipped its fetch.
+func (m *targetMetrics) skipped(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.up.WithLabelValues(endpoint).Set(0)
+	m.circuitState.WithLabelValues(endpoint).Set(circuitOpen)
+}
+
+func (m *targetMetrics) setCircuitState(endpoint string, state int) {
+	if m == nil {
+		return
+	}
+	m.circuitState.WithLabelValues(endpoint).Set(float64(state))
+}
+
+func (m *targetMetrics) setResponseBytes(endpoint string, n int64) {
+	if m == nil {
+		return
+	}
+	m.lastResponseBytes.WithLabelValues(endpoint).Set(float64(n))
+}
+
+// masterClockSkew returns the gauge set from the Date header of the
+// responses, or nil for agents.
+func (m *targetMetrics) masterClockSkew() prometheus.Gauge {
+	if m == nil || m.clockSkew == nil {
+		return nil
+	}
+	return m.clockSkew
+}
+
+// tokenIssued records a strict mode token issued at issued and expiring at
+// expiry.
+func (m *targetMetrics) tokenIssued(issued time.Time, expiry int64) {
+	if m == nil {
+		return
+	}
+	m.authTokenIssued.Set(float64(issued.Unix()))
+	m.authTokenExpiry.Set(float64(expiry))
+}
+
+func (m *targetMetrics) tokenReused() {
+	if m == nil {
+		return
+	}
+	m.authTokenReuses.Inc()
+}
+
+func (m *targetMetrics) tokenRefreshed() {
+	if m == nil {
+		return
+	}
+	m.authTokenRefreshes.Inc()
+}
+
+func (m *targetMetrics) setAuthHealthy(healthy bool) {
+	if m == nil {
+		return
+	}
+	if healthy {
+		m.authHealthy.Set(1)
+	} else {
+		m.authHealthy.Set(0)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// masterTarget is a single master entry of the -masters file. Every target
+// is scraped with its own credentials and TLS settings, and all of its
+// metrics carry a "cluster" label.
+type masterTarget struct {
+	Cluster       string   `json:"cluster"`
+	URL           string   `json:"url"`
+	Username      string   `json:"username"`
+	Password      string   `json:"password"`
+	AuthScheme    string   `json:"authScheme"`
+	TokenFile     string   `json:"tokenFile"`
+	StrictMode    bool     `json:"strictMode"`
+	PrivateKey    string   `json:"privateKey"`
+	LoginURL      string   `json:"loginURL"`
+	SkipSSLVerify bool     `json:"skipSSLVerify"`
+	TrustedCerts  []string `json:"trustedCerts"`
+	ClientCert    string   `json:"clientCert"`
+	ClientKey     string   `json:"clientKey"`
+}
+
+type masterTargets struct {
+	Masters []masterTarget `json:"masters"`
+}
+
+func loadMasterTargets(path string) ([]masterTarget, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets masterTargets
+	if err := json.NewDecoder(f).Decode(&targets); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %s", path, err)
+	}
+	if len(targets.Masters) == 0 {
+		return nil, fmt.Errorf("no masters listed in %s", path)
+	}
+
+	clusters := map[string]bool{}
+	for _, t := range targets.Masters {
+		if t.Cluster == "" || t.URL == "" {
+			return nil, fmt.Errorf("every master needs both a cluster and a url")
+		}
+		if clusters[t.Cluster] {
+			return nil, fmt.Errorf("duplicate cluster %q", t.Cluster)
+		}
+		clusters[t.Cluster] = true
+		if t.AuthScheme != "" && t.AuthScheme != "basic" && t.AuthScheme != "digest" {
+			return nil, fmt.Errorf("cluster %q: authScheme must be basic or digest", t.Cluster)
+		}
+		if t.TokenFile != "" && t.StrictMode {
+			return nil, fmt.Errorf("cluster %q: tokenFile and strictMode are mutually exclusive", t.Cluster)
+		}
+		if (t.ClientCert == "") != (t.ClientKey == "") {
+			return nil, fmt.Errorf("cluster %q: must supply both clientCert and clientKey to use TLS mutual auth", t.Cluster)
+		}
+	}
+	return targets.Masters, nil
+}
+
+// authInfo returns the credentials of the target, with the login URL and
+// authentication scheme of the flags unless it has its own. Its token file
+// is read again every tokenFileRefresh, like -tokenFile.
+func (t masterTarget) authInfo(defaultLoginURL, defaultAuthScheme string, tokenFileRefresh time.Duration) (authInfo, error) {
+	scheme := t.AuthScheme
+	if scheme == "" {
+		scheme = defaultAuthScheme
+	}
+	auth := authInfo{
+		username:      t.Username,
+		password:      t.Password,
+		strictMode:    t.StrictMode,
+		privateKey:    t.PrivateKey,
+		skipSSLVerify: t.SkipSSLVerify,
+		loginURL:      t.LoginURL,
+		digest:        scheme == "digest",
+	}
+	if auth.loginURL == "" {
+		auth.loginURL = defaultLoginURL
+	}
+	if t.TokenFile != "" {
+		f, err := newTokenFile(t.TokenFile, tokenFileRefresh)
+		if err != nil {
+			return authInfo{}, err
+		}
+		auth.tokenFile = f
+	}
+	return auth, nil
+}
+
+func (t masterTarget) tlsConfig() (*x509.CertPool, []tls.Certificate) {
+	var certPool *x509.CertPool
+	if len(t.TrustedCerts) > 0 {
+		certPool = getX509CertPool(t.TrustedCerts)
+	}
+	var certs []tls.Certificate
+	if t.ClientCert != "" {
+		certs = getX509ClientCertificates(t.ClientCert, t.ClientKey)
+	}
+	return certPool, certs
+}
+
+// labeledGatherer adds a fixed set of labels to every metric gathered from
+// the wrapped Gatherer.
+type labeledGatherer struct {
+	prometheus.Gatherer
+	labels []*dto.LabelPair
+}
+
+func newLabeledGatherer(g prometheus.Gatherer, labels prometheus.Labels) prometheus.Gatherer {
+	pairs := []*dto.LabelPair{}
+	for name, value := range labels {
+		pairs = append(pairs, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+	return &labeledGatherer{g, pairs}
+}
+
+func (g *labeledGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			m.Label = append(m.Label, g.labels...)
+		}
+	}
+	return mfs, err
+}
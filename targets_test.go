@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoadMasterTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		data     string
+		clusters []string
+	}{
+		{`{"masters": [{"cluster": "a", "url": "http://a:5050"}, {"cluster": "b", "url": "http://b:5050", "username": "u"}]}`, []string{"a", "b"}},
+		{`{"masters": []}`, nil},
+		{`{"masters": [{"cluster": "a", "url": "http://a:5050"}, {"cluster": "a", "url": "http://b:5050"}]}`, nil},
+		{`{"masters": [{"url": "http://a:5050"}]}`, nil},
+		{`{"masters": [{"cluster": "a", "url": "http://a:5050", "clientCert": "cert.pem"}]}`, nil},
+		{`{"masters": [{"cluster": "a", "url": "http://a:5050", "authScheme": "ntlm"}]}`, nil},
+		{`{"masters": [{"cluster": "a", "url": "http://a:5050", "tokenFile": "token", "strictMode": true}]}`, nil},
+	} {
+		path := filepath.Join(dir, "masters.json")
+		if err := ioutil.WriteFile(path, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		targets, err := loadMasterTargets(path)
+		if (err == nil) != (tt.clusters != nil) {
+			t.Errorf("%s: got error %v", tt.data, err)
+			continue
+		}
+		var clusters []string
+		for _, target := range targets {
+			clusters = append(clusters, target.Cluster)
+		}
+		if !reflect.DeepEqual(clusters, tt.clusters) {
+			t.Errorf("%s: got clusters %v, want %v", tt.data, clusters, tt.clusters)
+		}
+	}
+}
+
+func TestMasterTarget_AuthInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The stub only takes digest credentials and the token of its cluster.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		switch {
+		case authorization == "token=t0ken":
+		case strings.HasPrefix(authorization, "Digest "):
+			if p, _ := digestParams(authorization); p["username"] != "alice" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		default:
+			w.Header().Set("WWW-Authenticate", `Digest realm="mesos", nonce="n0nce", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"version": "1.7.2"}`))
+	}))
+	defer ts.Close()
+	if err := ioutil.WriteFile(filepath.Join(dir, "token"), []byte("t0ken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "masters.json")
+	data := fmt.Sprintf(`{"masters": [
+  {"cluster": "digest", "url": %q, "username": "alice", "password": "secret", "authScheme": "digest"},
+  {"cluster": "default", "url": %[1]q, "username": "alice", "password": "secret"},
+  {"cluster": "token", "url": %[1]q, "tokenFile": %q}
+]}`, ts.URL, filepath.Join(dir, "token"))
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := loadMasterTargets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The masters without an authScheme use -authScheme.
+	for _, defaultAuthScheme := range []string{"basic", "digest"} {
+		for _, target := range targets {
+			auth, err := target.authInfo("", defaultAuthScheme, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := mkHTTPClient(target.URL, httpOptions{timeout: time.Second}, auth, nil, nil)
+			var vf versionFields
+			ok := client.fetchAndDecode("/version", &vf)
+			if want := target.Cluster != "default" || defaultAuthScheme == "digest"; ok != want {
+				t.Errorf("-authScheme %s, cluster %s: got ok %v, want %v", defaultAuthScheme, target.Cluster, ok, want)
+			}
+		}
+	}
+}
+
+func TestLabeledGatherer(t *testing.T) {
+	// Every cluster registers the same metrics, which only the cluster
+	// label tells apart once merged.
+	registry := func(up float64) *prometheus.Registry {
+		r := prometheus.NewRegistry()
+		g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "mesos_up", Help: "up"}, []string{"endpoint"})
+		g.WithLabelValues("/state").Set(up)
+		r.MustRegister(g)
+		return r
+	}
+	gatherers := prometheus.Gatherers{
+		newLabeledGatherer(registry(1), prometheus.Labels{"cluster": "a"}),
+		newLabeledGatherer(registry(0), prometheus.Labels{"cluster": "b"}),
+	}
+
+	mfs, err := gatherers.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "mesos_up" {
+		t.Fatalf("got %v, want a single mesos_up family", mfs)
+	}
+	got := map[string]float64{}
+	for _, m := range mfs[0].Metric {
+		if endpoint := labelValue(m, "endpoint"); endpoint != "/state" {
+			t.Errorf("got endpoint %q, want /state", endpoint)
+		}
+		got[labelValue(m, "cluster")] = m.GetGauge().GetValue()
+	}
+	if want := map[string]float64{"a": 1, "b": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
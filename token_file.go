@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenFile holds an authentication token issued out of band. The file is
+// read again every refresh interval and on SIGHUP, so the token can be
+// rotated without restarting the exporter.
+type tokenFile struct {
+	sync.RWMutex
+	path  string
+	token string
+}
+
+func newTokenFile(path string, refresh time.Duration) (*tokenFile, error) {
+	f := &tokenFile{path: path}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		tick := time.Tick(refresh)
+		for {
+			select {
+			case <-tick:
+			case <-hup:
+				log.WithField("file", path).Info("reloading token file")
+			}
+			if err := f.load(); err != nil {
+				log.WithFields(log.Fields{
+					"file":  path,
+					"error": err,
+				}).Error("Error reading token file")
+				errorCounter.WithLabelValues("", "token_file").Inc()
+			}
+		}
+	}()
+	return f, nil
+}
+
+func (f *tokenFile) load() error {
+	content, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return fmt.Errorf("token file %s is empty", f.path)
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.token = token
+	return nil
+}
+
+// get returns the value of the Authorization header.
+func (f *tokenFile) get() string {
+	f.RLock()
+	defer f.RUnlock()
+	if strings.HasPrefix(f.token, "token=") {
+		return f.token
+	}
+	return "token=" + f.token
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTokenFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	tf := &tokenFile{path: f.Name()}
+	if err := tf.load(); err == nil {
+		t.Error("got no error for an empty token file")
+	}
+
+	for _, tt := range []struct {
+		content string
+		want    string
+	}{
+		{"abc\n", "token=abc"},
+		{"token=def", "token=def"},
+	} {
+		if err := ioutil.WriteFile(f.Name(), []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := tf.load(); err != nil {
+			t.Fatal(err)
+		}
+		if got := tf.get(); got != tt.want {
+			t.Errorf("got: %q, want: %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+//go:build zk
+// +build zk
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+const zkSessionTimeout = 10 * time.Second
+
+// newZKEndpoints follows the leading master registered in ZooKeeper. The
+// returned list always holds the current leader only and is updated
+// whenever the leadership changes.
+func newZKEndpoints(zkURL, scheme string) (*endpointList, error) {
+	servers, path, err := parseZKURL(zkURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, _, err := zk.Connect(servers, zkSessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetLogger(zkLogger{})
+
+	l := &endpointList{}
+	events, err := zkWatchLeader(conn, path, scheme, l)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			<-events
+			for {
+				events, err = zkWatchLeader(conn, path, scheme, l)
+				if err == nil {
+					break
+				}
+				log.WithFields(log.Fields{
+					"path":  path,
+					"error": err,
+				}).Error("Error reading leading master from ZooKeeper")
+				errorCounter.WithLabelValues("", "discovery").Inc()
+				time.Sleep(zkSessionTimeout)
+			}
+		}
+	}()
+	return l, nil
+}
+
+// zkWatchLeader stores the current leader in l and returns a channel which
+// fires on the next change of the master znodes.
+func zkWatchLeader(conn *zk.Conn, path, scheme string, l *endpointList) (<-chan zk.Event, error) {
+	children, _, events, err := conn.ChildrenW(path)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := zkLeaderNode(children)
+	if !ok {
+		log.WithField("path", path).Warn("no leading master registered in ZooKeeper")
+		l.set(nil)
+		return events, nil
+	}
+
+	data, _, err := conn.Get(path + "/" + node)
+	if err != nil {
+		return nil, err
+	}
+	var info zkMasterInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	url, err := info.url(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("master", url).Debug("leading master changed")
+	l.set([]string{url})
+	return events, nil
+}
+
+type zkLogger struct{}
+
+func (zkLogger) Printf(format string, args ...interface{}) {
+	log.Debugf(format, args...)
+}
@@ -0,0 +1,10 @@
+//go:build !zk
+// +build !zk
+
+package main
+
+import "errors"
+
+func newZKEndpoints(zkURL, scheme string) (*endpointList, error) {
+	return nil, errors.New("ZooKeeper discovery is not supported by this build, rebuild with -tags zk")
+}